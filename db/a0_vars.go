@@ -17,6 +17,12 @@ var (
 	bSQLSet      = []byte(" SET ")
 	bSQLFrom     = []byte(" FROM ")
 	bSQLWhere    = []byte(" WHERE ")
+	bSQLAnd      = []byte(" AND ")
+	bSQLAsA      = []byte(" AS a")
+	bSQLAs       = []byte(" AS ")
+	bSQLWith     = []byte("WITH ")
+	bSQLUnion    = []byte(" UNION ")
+	bSQLUnionAll = []byte(" UNION ALL ")
 	bSQLOrder    = []byte(" ORDER BY ")
 	bSQLLimit    = []byte(" LIMIT ")
 	bSQLLimitOne = []byte(" LIMIT 1")
@@ -1,16 +1,26 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/kere/gno/libs/conf"
 	"github.com/kere/gno/libs/log"
 )
 
+const (
+	confParamPrefix = "param."
+)
+
 var (
 	dbpool *databasePool
+
+	envReg = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
 )
 
 func init() {
@@ -57,17 +67,69 @@ func (dp *databasePool) GetDatabase(name string) *Database {
 
 // Init it
 func Init(name string, config map[string]string) {
-	fmt.Println("Init Database", config)
+	fmt.Println("Init Database", maskConf(config))
 	dbpool.SetCurrent(New(name, config))
 }
 
+// maskConf hide password for printing
+func maskConf(config map[string]string) map[string]string {
+	if _, ok := config["password"]; !ok {
+		return config
+	}
+	c := make(map[string]string, len(config))
+	for k, v := range config {
+		c[k] = v
+	}
+	c["password"] = "***"
+	return c
+}
+
+// confGet value, ${ENV} is replaced by environment variable
 func confGet(config map[string]string, key, defaultValue string) string {
 	if v, ok := config[key]; ok {
-		return v
+		return expandEnv(v)
 	}
 	return defaultValue
 }
 
+// expandEnv replace ${NAME} only, a single $ is kept for passwords
+func expandEnv(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return envReg.ReplaceAllStringFunc(s, func(m string) string {
+		return os.Getenv(m[2 : len(m)-1])
+	})
+}
+
+// confPassword password_file is read if it is set
+func confPassword(c map[string]string) (string, error) {
+	name := confGet(c, "password_file", "")
+	if name == "" {
+		return confGet(c, "password", "123"), nil
+	}
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(src)), nil
+}
+
+// confParams param.key=value extra parameters
+func confParams(c map[string]string) map[string]string {
+	var params map[string]string
+	for k := range c {
+		if !strings.HasPrefix(k, confParamPrefix) {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[k[len(confParamPrefix):]] = confGet(c, k, "")
+	}
+	return params
+}
+
 // New func
 // create a database instance
 func New(name string, c map[string]string) *Database {
@@ -83,14 +145,29 @@ func New(name string, c map[string]string) *Database {
 	logger := NewLogger(c)
 
 	var driver IDriver
+	// returned by Connect
+	var confErr error
 	switch driverName {
 	case "postgres", "psql":
+		password, err := confPassword(c)
+		if err != nil {
+			confErr = errors.New(name + " database password_file: " + err.Error())
+		}
 		driver = &Postgres{DBName: confGet(c, "dbname", "app"),
 			User:     confGet(c, "user", "postgres"),
-			Password: confGet(c, "password", "123"),
+			Password: password,
 			Host:     confGet(c, "host", "127.0.0.1"),
 			HostAddr: confGet(c, "hostaddr", ""),
 			Port:     confGet(c, "port", "5432"),
+
+			SSLMode:          confGet(c, "sslmode", ""),
+			SSLRootCert:      confGet(c, "sslrootcert", ""),
+			SSLCert:          confGet(c, "sslcert", ""),
+			SSLKey:           confGet(c, "sslkey", ""),
+			ApplicationName:  confGet(c, "application_name", ""),
+			ConnectTimeout:   confGet(c, "connect_timeout", ""),
+			StatementTimeout: confGet(c, "statement_timeout", ""),
+			Params:           confParams(c),
 		}
 
 	// case "mysql":
@@ -111,12 +188,20 @@ func New(name string, c map[string]string) *Database {
 
 	// driver.SetConnectString(confGet(c, "connect"))
 	d := NewDatabase(name, driver, conf.Conf(c), logger)
+	d.confErr = confErr
 
 	dbpool.SetDatabase(name, d)
 	dbpool.SetCurrent(d)
 	return d
 }
 
+// RegistDatabase add a database instance into pool and use it as current.
+// it replaces the database with the same name.
+func RegistDatabase(d *Database) {
+	dbpool.SetDatabase(d.Name, d)
+	dbpool.SetCurrent(d)
+}
+
 // Get a database instance by name from database pool
 func Get(name string) *Database {
 	return dbpool.GetDatabase(name)
@@ -135,6 +220,17 @@ func Use(name string) {
 	dbpool.Use(name)
 }
 
+// CloseAll close listeners and connection pools of all databases
+func CloseAll() error {
+	var err error
+	for _, d := range dbpool.dblist {
+		if e := d.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // DatabaseCount Get database count
 func DatabaseCount() int {
 	return len(dbpool.dblist)
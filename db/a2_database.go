@@ -1,12 +1,17 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kere/gno/libs/conf"
 	"github.com/kere/gno/libs/log"
+	"github.com/kere/gno/libs/util"
 )
 
 // IDriver interface
@@ -30,6 +35,16 @@ type IDriver interface {
 	FloatsP([]byte) ([]float64, error)
 	Ints([]byte) ([]int, error)
 	IntsP([]byte) ([]int, error)
+
+	Time([]byte) (time.Time, error)
+	Bool([]byte) (bool, error)
+	HStore([]byte) (util.MapData, error)
+	Range([]byte) (Range, error)
+}
+
+// ISQLDriver driver registered in database/sql by another name than the dialect Name
+type ISQLDriver interface {
+	SQLDriverName() string
 }
 
 // Database class
@@ -39,6 +54,21 @@ type Database struct {
 	log    *log.Logger
 
 	db *sql.DB
+	// confErr config can not be read, it is returned by Connect
+	confErr error
+
+	listener   *dbListener
+	listenLock sync.Mutex
+
+	locks     map[string]*heldLock
+	locksLock sync.Mutex
+
+	// *dbStats, nil if disabled
+	stats     atomic.Value
+	statsLock sync.Mutex
+
+	// column types of tables for UpdateM, table: map[field]type
+	colTypes sync.Map
 
 	MaxOpenConns    int
 	MaxIdleConns    int
@@ -51,6 +81,7 @@ func NewDatabase(name string, driver IDriver, dbConf conf.Conf, lg *log.Logger)
 	d.MaxOpenConns = dbConf.DefaultInt("max_open_conns", 300)
 	d.MaxIdleConns = dbConf.DefaultInt("max_idle_conns", 50)
 	d.ConnMaxLifetime = dbConf.DefaultInt("conn_max_life_time", 30)
+	d.EnableStats(dbConf.DefaultBool("stats", false))
 
 	return d
 }
@@ -120,9 +151,31 @@ func (d *Database) DB() *sql.DB {
 	return d.db
 }
 
+// Close listener and connection pool, DB() connects again if it is called later
+func (d *Database) Close() error {
+	err := d.CloseListener()
+	if d.db == nil {
+		return err
+	}
+	if e := d.db.Close(); e != nil {
+		err = e
+	}
+	d.db = nil
+	return err
+}
+
 // Connect db
 func (d *Database) Connect() (*sql.DB, error) {
-	db, err := sql.Open(d.Driver.Name(), d.Driver.ConnectString())
+	if d.confErr != nil {
+		d.log.Crit(d.confErr)
+		// every connection fails with confErr
+		return sql.OpenDB(errConnector{err: d.confErr}), d.confErr
+	}
+	name := d.Driver.Name()
+	if sd, ok := d.Driver.(ISQLDriver); ok {
+		name = sd.SQLDriverName()
+	}
+	db, err := sql.Open(name, d.Driver.ConnectString())
 	if err != nil {
 		d.log.Crit(err)
 		return db, err
@@ -135,6 +188,25 @@ func (d *Database) Connect() (*sql.DB, error) {
 	return db, nil
 }
 
+// errConnector connector of a database whose config can not be read
+type errConnector struct {
+	err error
+}
+
+func (c errConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c errConnector) Driver() driver.Driver {
+	return errDriver(c)
+}
+
+type errDriver errConnector
+
+func (d errDriver) Open(string) (driver.Conn, error) {
+	return nil, d.err
+}
+
 // Log db
 func (d *Database) Log(sql string, args []interface{}) {
 	d.log.Sql(d.Name, sql, args)
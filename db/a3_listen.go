@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	sSQLNotify = "SELECT pg_notify($1, $2)"
+
+	listenMinReconnect = 2 * time.Second
+	listenMaxReconnect = time.Minute
+	listenPingInterval = 90 * time.Second
+)
+
+var (
+	// ErrListenNotSupported driver is not postgres
+	ErrListenNotSupported = errors.New("listen/notify is only supported by postgres")
+)
+
+// dbListener dedicated connection of LISTEN, reconnect automatically
+type dbListener struct {
+	database *Database
+	listener *pq.Listener
+	handlers map[string][]*listenHandler
+	// LISTEN in progress by channel
+	pending map[string]*listenPending
+	// called after reconnected
+	reconnects []func()
+	lock       sync.RWMutex
+	done       chan struct{}
+	// listen LISTEN channel, l.listener.Listen
+	listen func(channel string) error
+}
+
+type listenHandler struct {
+	f func(payload string)
+}
+
+// listenPending first LISTEN of a channel, later Listens of the channel wait for it
+type listenPending struct {
+	done chan struct{}
+	err  error
+}
+
+// Listen postgres channel, f is called in the listener goroutine.
+// Listen blocks until the listener connection is established or the listener is closed,
+// use ListenContext to limit the time while the database is down.
+// The listener connection reconnects automatically, notifications sent while reconnecting are lost,
+// use OnListenReconnect to reload the state.
+func (d *Database) Listen(channel string, f func(payload string)) error {
+	return d.ListenContext(context.Background(), channel, f)
+}
+
+// ListenContext Listen, f is removed and ctx.Err() is returned if ctx is done
+// before the channel is listened.
+// Concurrent Listens of a new channel wait for the same LISTEN and return its error,
+// more handlers of a listened channel are added without waiting.
+func (d *Database) ListenContext(ctx context.Context, channel string, f func(payload string)) error {
+	if d.Driver.Name() != DriverPSQL {
+		return ErrListenNotSupported
+	}
+
+	l := d.getListener()
+	h := &listenHandler{f: f}
+	l.lock.Lock()
+	p, isPending := l.pending[channel]
+	_, isListened := l.handlers[channel]
+	l.handlers[channel] = append(l.handlers[channel], h)
+	if isListened && !isPending {
+		l.lock.Unlock()
+		return nil
+	}
+	if !isPending {
+		p = &listenPending{done: make(chan struct{})}
+		l.pending[channel] = p
+		go l.listenChannel(channel, p)
+	}
+	l.lock.Unlock()
+
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		l.removeHandler(channel, h)
+		return ctx.Err()
+	}
+}
+
+// listenChannel LISTEN channel, handlers of the channel are removed if it fails
+func (l *dbListener) listenChannel(channel string, p *listenPending) {
+	err := l.listen(channel)
+	if err == pq.ErrChannelAlreadyOpen {
+		err = nil
+	}
+	l.lock.Lock()
+	delete(l.pending, channel)
+	if err != nil {
+		delete(l.handlers, channel)
+	}
+	p.err = err
+	close(p.done)
+	l.lock.Unlock()
+}
+
+func (l *dbListener) removeHandler(channel string, h *listenHandler) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	handlers := l.handlers[channel]
+	for i := range handlers {
+		if handlers[i] != h {
+			continue
+		}
+		if len(handlers) == 1 {
+			delete(l.handlers, channel)
+			return
+		}
+		l.handlers[channel] = append(handlers[:i:i], handlers[i+1:]...)
+		return
+	}
+}
+
+// OnListenReconnect f is called in the listener goroutine after the listener connection is reestablished
+func (d *Database) OnListenReconnect(f func()) error {
+	if d.Driver.Name() != DriverPSQL {
+		return ErrListenNotSupported
+	}
+	l := d.getListener()
+	l.lock.Lock()
+	l.reconnects = append(l.reconnects, f)
+	l.lock.Unlock()
+	return nil
+}
+
+// getListener create listener if it is nil
+func (d *Database) getListener() *dbListener {
+	d.listenLock.Lock()
+	defer d.listenLock.Unlock()
+	if d.listener == nil {
+		d.listener = newDBListener(d)
+	}
+	return d.listener
+}
+
+// Unlisten channel, remove all handlers
+func (d *Database) Unlisten(channel string) error {
+	d.listenLock.Lock()
+	defer d.listenLock.Unlock()
+	if d.listener == nil {
+		return nil
+	}
+	l := d.listener
+	l.lock.Lock()
+	delete(l.handlers, channel)
+	l.lock.Unlock()
+	err := l.listener.Unlisten(channel)
+	if err == pq.ErrChannelNotOpen {
+		return nil
+	}
+	return err
+}
+
+// CloseListener close the listener connection
+func (d *Database) CloseListener() error {
+	d.listenLock.Lock()
+	defer d.listenLock.Unlock()
+	if d.listener == nil {
+		return nil
+	}
+	close(d.listener.done)
+	err := d.listener.listener.Close()
+	d.listener = nil
+	return err
+}
+
+// Notify send notification by pg_notify
+func (d *Database) Notify(channel, payload string) error {
+	if d.Driver.Name() != DriverPSQL {
+		return ErrListenNotSupported
+	}
+	b := d.NewBuilder("")
+	_, err := b.Exec(sSQLNotify, []interface{}{channel, payload})
+	return err
+}
+
+// Notify send notification in transaction, it is delivered after commit,
+// and dropped if the transaction rollbacks.
+func (t *Tx) Notify(channel, payload string) error {
+	if t.database.Driver.Name() != DriverPSQL {
+		return ErrListenNotSupported
+	}
+	b := t.NewBuilder("")
+	_, err := b.Exec(sSQLNotify, []interface{}{channel, payload})
+	return err
+}
+
+func newDBListener(d *Database) *dbListener {
+	l := newListener(d)
+	l.listener = pq.NewListener(d.Driver.ConnectString(), listenMinReconnect, listenMaxReconnect, l.onEvent)
+	l.listen = l.listener.Listen
+	go l.run()
+	return l
+}
+
+func newListener(d *Database) *dbListener {
+	return &dbListener{
+		database: d,
+		handlers: make(map[string][]*listenHandler),
+		pending:  make(map[string]*listenPending),
+		done:     make(chan struct{}),
+	}
+}
+
+func (l *dbListener) onEvent(ev pq.ListenerEventType, err error) {
+	switch ev {
+	case pq.ListenerEventDisconnected:
+		l.database.log.Warn("listener disconnected", err)
+	case pq.ListenerEventReconnected:
+		l.database.log.Info("listener reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		l.database.log.Warn("listener connect failed", err)
+	}
+}
+
+func (l *dbListener) run() {
+	ticker := time.NewTicker(listenPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+
+		case n, ok := <-l.listener.Notify:
+			if !ok {
+				return
+			}
+			// nil after reconnected
+			if n == nil {
+				l.lock.RLock()
+				reconnects := l.reconnects
+				l.lock.RUnlock()
+				for _, f := range reconnects {
+					l.callReconnect(f)
+				}
+				continue
+			}
+			l.lock.RLock()
+			handlers := l.handlers[n.Channel]
+			l.lock.RUnlock()
+			for _, h := range handlers {
+				l.call(h.f, n.Extra)
+			}
+
+		case <-ticker.C:
+			go l.listener.Ping()
+		}
+	}
+}
+
+// callReconnect reconnect handler, recover panic
+func (l *dbListener) callReconnect(f func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			l.database.log.Alert("listener reconnect handler panic:", p).Stack()
+		}
+	}()
+	f()
+}
+
+// call handler, recover panic
+func (l *dbListener) call(f func(string), payload string) {
+	defer func() {
+		if p := recover(); p != nil {
+			l.database.log.Alert("listener handler panic:", p).Stack()
+		}
+	}()
+	f(payload)
+}
@@ -0,0 +1,323 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sSQLPGTryLock = "SELECT pg_try_advisory_lock($1)"
+	sSQLPGLock    = "SELECT pg_advisory_lock($1)"
+	sSQLPGUnlock  = "SELECT pg_advisory_unlock($1)"
+
+	sSQLMyTryLock = "SELECT GET_LOCK(?, 0)"
+	sSQLMyLock    = "SELECT GET_LOCK(?, -1)"
+	sSQLMyUnlock  = "SELECT RELEASE_LOCK(?)"
+)
+
+var (
+	// ErrLockNotHeld unlock a key which is not locked
+	ErrLockNotHeld = errors.New("advisory lock is not held")
+)
+
+// heldLock session lock, the connection is kept until unlock.
+// The entry is added before acquiring, conn is nil until it is held.
+type heldLock struct {
+	conn *sql.Conn
+	arg  interface{}
+	// closed when the entry is removed
+	released chan struct{}
+}
+
+// LockKey postgres advisory lock key of name
+func LockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func (d *Database) lockArg(key string) interface{} {
+	if d.Driver.Name() == DriverMySQL {
+		return key
+	}
+	return LockKey(key)
+}
+
+func (d *Database) lockSQL(isTry bool) string {
+	isMySQL := d.Driver.Name() == DriverMySQL
+	switch {
+	case isTry && isMySQL:
+		return sSQLMyTryLock
+	case isTry:
+		return sSQLPGTryLock
+	case isMySQL:
+		return sSQLMyLock
+	}
+	return sSQLPGLock
+}
+
+// TryLock session advisory lock without waiting, return true if it is acquired.
+// A key is held once in a database, it returns false if the key is held or being acquired
+// by another goroutine.
+func (d *Database) TryLock(key string) (bool, error) {
+	return d.lock(context.Background(), key, true)
+}
+
+// Lock session advisory lock, wait until it is acquired or ctx is done.
+// Goroutines of the same database locking a key wait for each other.
+func (d *Database) Lock(ctx context.Context, key string) error {
+	_, err := d.lock(ctx, key, false)
+	return err
+}
+
+func (d *Database) lock(ctx context.Context, key string, isTry bool) (bool, error) {
+	l, err := d.ownLock(ctx, key, isTry)
+	if l == nil {
+		return false, err
+	}
+
+	conn, err := d.DB().Conn(ctx)
+	if err != nil {
+		d.releaseLock(key, l)
+		return false, err
+	}
+
+	row := conn.QueryRowContext(ctx, d.lockSQL(isTry), l.arg)
+	var ok bool
+	if isTry {
+		err = row.Scan(&ok)
+	} else {
+		// pg_advisory_lock returns void
+		var v interface{}
+		err = row.Scan(&v)
+		ok = err == nil
+	}
+	if err != nil {
+		// the lock may be acquired after the error
+		discardConn(conn)
+		d.releaseLock(key, l)
+		return false, err
+	}
+	if !ok {
+		conn.Close()
+		d.releaseLock(key, l)
+		return false, nil
+	}
+
+	d.locksLock.Lock()
+	l.conn = conn
+	d.locksLock.Unlock()
+	return true, nil
+}
+
+// ownLock add the entry of key, wait until the entry of other goroutine is released.
+// It returns nil if isTry and the key is taken.
+func (d *Database) ownLock(ctx context.Context, key string, isTry bool) (*heldLock, error) {
+	for {
+		d.locksLock.Lock()
+		l, ok := d.locks[key]
+		if !ok {
+			if d.locks == nil {
+				d.locks = make(map[string]*heldLock)
+			}
+			l = &heldLock{arg: d.lockArg(key), released: make(chan struct{})}
+			d.locks[key] = l
+			d.locksLock.Unlock()
+			return l, nil
+		}
+		d.locksLock.Unlock()
+
+		if isTry {
+			return nil, nil
+		}
+		select {
+		case <-l.released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// releaseLock remove the entry and wake waiters
+func (d *Database) releaseLock(key string, l *heldLock) {
+	d.locksLock.Lock()
+	if d.locks[key] == l {
+		delete(d.locks, key)
+		close(l.released)
+	}
+	d.locksLock.Unlock()
+}
+
+// Unlock release the advisory lock of key
+func (d *Database) Unlock(key string) error {
+	d.locksLock.Lock()
+	l, ok := d.locks[key]
+	var conn *sql.Conn
+	if ok {
+		// taken by this Unlock, waiters go on after the session lock is released
+		conn, l.conn = l.conn, nil
+	}
+	d.locksLock.Unlock()
+	if conn == nil {
+		return ErrLockNotHeld
+	}
+	defer d.releaseLock(key, l)
+
+	sqlstr := sSQLPGUnlock
+	if d.Driver.Name() == DriverMySQL {
+		sqlstr = sSQLMyUnlock
+	}
+	var v interface{}
+	err := conn.QueryRowContext(context.Background(), sqlstr, l.arg).Scan(&v)
+	if err != nil {
+		// the session may still hold the lock, it must not go back to the pool
+		discardConn(conn)
+		return err
+	}
+	return conn.Close()
+}
+
+// discardConn close conn and remove it from the pool, the session locks are released by the server
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	conn.Close()
+}
+
+// isLockAlive ping the lock connection
+func (d *Database) isLockAlive(key string) bool {
+	d.locksLock.Lock()
+	l, ok := d.locks[key]
+	var conn *sql.Conn
+	if ok {
+		conn = l.conn
+	}
+	d.locksLock.Unlock()
+	if conn == nil {
+		return false
+	}
+	if err := conn.PingContext(context.Background()); err != nil {
+		d.locksLock.Lock()
+		isHeld := l.conn == conn
+		l.conn = nil
+		d.locksLock.Unlock()
+		if isHeld {
+			discardConn(conn)
+			d.releaseLock(key, l)
+		}
+		return false
+	}
+	return true
+}
+
+// Leader election by session advisory lock.
+// The instance holding the lock is the leader, others try again every interval.
+// Start and Stop are safe to call from multiple goroutines.
+type Leader struct {
+	Key      string
+	Interval time.Duration
+	// OnChange called when leadership changes
+	OnChange func(isLeader bool)
+
+	database *Database
+	isLeader int32
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	// lock of Start and Stop
+	lock sync.Mutex
+}
+
+// NewLeader leader election of key
+func (d *Database) NewLeader(key string, interval time.Duration, onChange func(isLeader bool)) *Leader {
+	return &Leader{Key: key, Interval: interval, OnChange: onChange, database: d}
+}
+
+// IsLeader now
+func (l *Leader) IsLeader() bool {
+	return atomic.LoadInt32(&l.isLeader) == 1
+}
+
+// Start election loop
+func (l *Leader) Start() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.stop != nil {
+		return
+	}
+	if l.Interval <= 0 {
+		l.Interval = 10 * time.Second
+	}
+	l.stop = make(chan struct{})
+	l.wg.Add(1)
+	go l.run()
+}
+
+// Stop election and release leadership
+func (l *Leader) Stop() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.stop == nil {
+		return
+	}
+	close(l.stop)
+	l.wg.Wait()
+	l.stop = nil
+	if l.IsLeader() {
+		l.database.Unlock(l.Key)
+		l.setLeader(false)
+	}
+}
+
+func (l *Leader) run() {
+	defer l.wg.Done()
+	l.check()
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.check()
+		}
+	}
+}
+
+func (l *Leader) check() {
+	if l.IsLeader() {
+		if !l.database.isLockAlive(l.Key) {
+			l.database.log.Warn("leader lost:", l.Key)
+			l.setLeader(false)
+		}
+		return
+	}
+
+	ok, err := l.database.TryLock(l.Key)
+	if err != nil {
+		l.database.log.Warn("leader try lock:", l.Key, err)
+		return
+	}
+	if ok {
+		l.setLeader(true)
+	}
+}
+
+func (l *Leader) setLeader(v bool) {
+	var n int32
+	if v {
+		n = 1
+	}
+	if atomic.SwapInt32(&l.isLeader, n) == n {
+		return
+	}
+	if l.OnChange != nil {
+		l.OnChange(v)
+	}
+}
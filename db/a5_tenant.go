@@ -0,0 +1,142 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/valyala/bytebufferpool"
+)
+
+const (
+	// search_path is reset when the transaction ends
+	sSQLSetSearchPath = "SET LOCAL search_path TO "
+)
+
+// Tenant database handle scoped by a postgres schema.
+// Builders of tenant run with search_path "name" only, tables of public are not
+// used silently, shared tables must be qualified as public.table.
+// A missing schema fails with "relation does not exist".
+// A statement out of transaction runs in an implicit transaction,
+// so the search_path never leaks to other connections of the pool.
+type Tenant struct {
+	Name       string
+	database   *Database
+	searchPath string
+}
+
+// ForTenant scoped handle of schema name, "" is the default schema
+func (d *Database) ForTenant(name string) *Tenant {
+	t := &Tenant{Name: name, database: d}
+	if name == "" {
+		return t
+	}
+	buf := bytebufferpool.Get()
+	d.Driver.WriteQuoteIdentifier(buf, name)
+	t.searchPath = buf.String()
+	bytebufferpool.Put(buf)
+	return t
+}
+
+// Database of tenant
+func (t *Tenant) Database() *Database {
+	return t.database
+}
+
+// SearchPath of tenant
+func (t *Tenant) SearchPath() string {
+	return t.searchPath
+}
+
+// Begin transaction with search_path of tenant
+func (t *Tenant) Begin() (Tx, error) {
+	var err error
+	tx := Tx{database: t.database}
+	tx.tx, err = t.database.DB().Begin()
+	if err != nil {
+		return tx, err
+	}
+	if err = setSearchPath(tx.tx, t.searchPath); err != nil {
+		tx.tx.Rollback()
+		return tx, err
+	}
+	return tx, nil
+}
+
+// NewBuilder of tenant
+func (t *Tenant) NewBuilder(table string) Builder {
+	b := t.database.NewBuilder(table)
+	b.searchPath = t.searchPath
+	return b
+}
+
+// NewQuery of tenant
+func (t *Tenant) NewQuery(table string) QueryBuilder {
+	q := t.database.NewQuery(table)
+	q.searchPath = t.searchPath
+	return q
+}
+
+// NewInsert of tenant
+func (t *Tenant) NewInsert(table string) InsertBuilder {
+	ins := t.database.NewInsert(table)
+	ins.searchPath = t.searchPath
+	return ins
+}
+
+// NewUpdate of tenant
+func (t *Tenant) NewUpdate(table string) UpdateBuilder {
+	u := t.database.NewUpdate(table)
+	u.searchPath = t.searchPath
+	return u
+}
+
+// NewDelete of tenant
+func (t *Tenant) NewDelete(table string) DeleteBuilder {
+	del := t.database.NewDelete(table)
+	del.searchPath = t.searchPath
+	return del
+}
+
+// NewExists of tenant
+func (t *Tenant) NewExists(table string) ExistsBuilder {
+	e := t.database.NewExists(table)
+	e.searchPath = t.searchPath
+	return e
+}
+
+func setSearchPath(tx *sql.Tx, searchPath string) error {
+	if searchPath == "" {
+		return nil
+	}
+	// searchPath is quoted by ForTenant
+	_, err := tx.Exec(sSQLSetSearchPath + searchPath)
+	return err
+}
+
+// inTenantTx run f in an implicit transaction with search_path of tenant.
+// f gets a copy of the builder bound to the transaction, b is not changed,
+// the transaction rollbacks if f fails or panics.
+func (b *Builder) inTenantTx(f func(tb *Builder) error) error {
+	d := b.GetDatabase()
+	tx, err := d.DB().Begin()
+	if err != nil {
+		return err
+	}
+	isCommitted := false
+	defer func() {
+		if !isCommitted {
+			tx.Rollback()
+		}
+	}()
+	if err = setSearchPath(tx, b.searchPath); err != nil {
+		return err
+	}
+
+	tb := *b
+	tb.tx, tb.isTx = tx, true
+	tb.dbtx = &Tx{tx: tx, database: d}
+	if err = f(&tb); err != nil {
+		return err
+	}
+	isCommitted = true
+	return tx.Commit()
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statSamples durations kept for p99 of each query
+	statSamples = 512
+	// statMaxQueries fingerprints kept, new queries are dropped when it is full
+	statMaxQueries = 2000
+	// statMaxCache raw sql cached for fingerprint
+	statMaxCache = 10000
+)
+
+var (
+	statStringReg = regexp.MustCompile(`'(?:[^']|'')*'`)
+	statNumberReg = regexp.MustCompile(`\b\d+(?:\.\d+)?\b|\$\d+`)
+	statListReg   = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	statValuesReg = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+	statSpaceReg  = regexp.MustCompile(`\s+`)
+)
+
+// QueryStat statistics of normalized sql
+type QueryStat struct {
+	SQL    string
+	Count  int64
+	Errors int64
+	Rows   int64
+	Total  time.Duration
+	Avg    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+// queryStat collector of one fingerprint
+type queryStat struct {
+	count   int64
+	errors  int64
+	rows    int64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration
+	next    int
+}
+
+// dbStats statistics of database
+type dbStats struct {
+	lock    sync.Mutex
+	queries map[string]*queryStat
+	// raw sql -> fingerprint
+	cache sync.Map
+	// cached count
+	cacheN int
+}
+
+// EnableStats collect query statistics in cQuery and Exec, it is safe to call while querying
+func (d *Database) EnableStats(v bool) {
+	d.statsLock.Lock()
+	defer d.statsLock.Unlock()
+	if !v {
+		d.stats.Store((*dbStats)(nil))
+		return
+	}
+	if d.getStats() == nil {
+		d.stats.Store(&dbStats{queries: make(map[string]*queryStat)})
+	}
+}
+
+// getStats nil if stats is disabled
+func (d *Database) getStats() *dbStats {
+	s, _ := d.stats.Load().(*dbStats)
+	return s
+}
+
+// Stats sorted by total duration desc
+func (d *Database) Stats() []QueryStat {
+	s := d.getStats()
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	arr := make([]QueryStat, 0, len(s.queries))
+	for sqlstr, q := range s.queries {
+		item := QueryStat{SQL: sqlstr, Count: q.count, Errors: q.errors, Rows: q.rows, Total: q.total, Max: q.max}
+		if q.count > 0 {
+			item.Avg = q.total / time.Duration(q.count)
+		}
+		item.P99 = percentile(q.samples, 0.99)
+		arr = append(arr, item)
+	}
+	s.lock.Unlock()
+
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i].Total > arr[j].Total
+	})
+	return arr
+}
+
+// ResetStats clear statistics
+func (d *Database) ResetStats() {
+	s := d.getStats()
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.queries = make(map[string]*queryStat)
+	s.lock.Unlock()
+}
+
+// record query
+func (s *dbStats) record(sqlstr string, dur time.Duration, rows int64, err error) {
+	fp := s.fingerprint(sqlstr)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	q, ok := s.queries[fp]
+	if !ok {
+		if len(s.queries) >= statMaxQueries {
+			return
+		}
+		q = &queryStat{}
+		s.queries[fp] = q
+	}
+	q.count++
+	q.total += dur
+	if dur > q.max {
+		q.max = dur
+	}
+	if err != nil {
+		q.errors++
+	} else {
+		q.rows += rows
+	}
+	if len(q.samples) < statSamples {
+		q.samples = append(q.samples, dur)
+	} else {
+		q.samples[q.next] = dur
+		q.next = (q.next + 1) % statSamples
+	}
+}
+
+func (s *dbStats) fingerprint(sqlstr string) string {
+	if v, ok := s.cache.Load(sqlstr); ok {
+		return v.(string)
+	}
+	fp := Fingerprint(sqlstr)
+	s.lock.Lock()
+	if s.cacheN < statMaxCache {
+		s.cacheN++
+		s.cache.Store(sqlstr, fp)
+	}
+	s.lock.Unlock()
+	return fp
+}
+
+// Fingerprint normalize sql: literals and placeholders as ?, lists and multi values collapsed
+//
+//	SELECT * FROM t WHERE id IN ($1,$2,$3) AND name='a' -> SELECT * FROM t WHERE id IN (?) AND name=?
+func Fingerprint(sqlstr string) string {
+	s := statStringReg.ReplaceAllString(sqlstr, "?")
+	s = statNumberReg.ReplaceAllString(s, "?")
+	s = statListReg.ReplaceAllString(s, "(?)")
+	s = statValuesReg.ReplaceAllString(s, "(?)")
+	s = statSpaceReg.ReplaceAllString(s, " ")
+	return strings.TrimRight(strings.TrimSpace(s), ";")
+}
+
+func percentile(samples []time.Duration, p float64) time.Duration {
+	n := len(samples)
+	if n == 0 {
+		return 0
+	}
+	arr := make([]time.Duration, n)
+	copy(arr, samples)
+	sort.Slice(arr, func(i, j int) bool {
+		return arr[i] < arr[j]
+	})
+	i := int(float64(n)*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= n {
+		i = n - 1
+	}
+	return arr[i]
+}
@@ -1,10 +1,20 @@
 package db
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/kere/gno/libs/log"
 	"github.com/kere/gno/libs/util"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var (
@@ -363,3 +373,529 @@ func TestPage(t *testing.T) {
 	PutDataSet(&ds)
 	PutRow(row)
 }
+
+func TestDataSetOps(t *testing.T) {
+	ds := NewDataSet([]string{"code", "date", "price"})
+	ds.AddRow([]interface{}{"a", int64(2), 1.5})
+	ds.AddRow([]interface{}{"b", int64(1), 2.5})
+	ds.AddRow([]interface{}{"a", int64(1), 3.0})
+	ds.AddRow([]interface{}{"c", int64(3), []byte("4.5")})
+
+	// 1: Filter
+	ds1 := ds.Filter(func(row DBRow) bool {
+		return row.String("code") == "a"
+	})
+	if ds1.Len() != 2 || ds1.Columns[2][1].(float64) != 3.0 {
+		PrintDataSet(&ds1)
+		t.Fatal()
+	}
+	PutDataSet(&ds1)
+
+	// 2: SortBy
+	if err := ds.SortBy("date", "price desc"); err != nil {
+		t.Fatal(err)
+	}
+	if ds.Columns[0][0].(string) != "a" || ds.Columns[0][1].(string) != "b" || ds.Columns[0][3].(string) != "c" {
+		PrintDataSet(&ds)
+		t.Fatal()
+	}
+	// int64 above 2^53
+	if compareValue(int64(1<<53+1), int64(1<<53)) != 1 || compareValue([]byte("9007199254740993"), []byte("9007199254740992")) != 1 {
+		t.Fatal("int64 compare")
+	}
+
+	// 3: GroupBy
+	ds1, err := ds.GroupBy("code", Aggregation{Func: AggCount, As: "n"}, Aggregation{Field: "price", Func: AggSum, As: "total"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds1.Len() != 3 || ds1.Fields[2] != "total" {
+		PrintDataSet(&ds1)
+		t.Fatal()
+	}
+	for i := 0; i < ds1.Len(); i++ {
+		if ds1.Columns[0][i].(string) == "a" && (ds1.Columns[1][i].(int64) != 2 || ds1.Columns[2][i].(float64) != 4.5) {
+			PrintDataSet(&ds1)
+			t.Fatal()
+		}
+	}
+	PutDataSet(&ds1)
+
+	// 4: Join
+	names := NewDataSet([]string{"code", "name"})
+	names.AddRow([]interface{}{"a", "Alpha"})
+	names.AddRow([]interface{}{"b", "Beta"})
+	ds1, err = ds.Join(&names, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds1.Len() != 3 || len(ds1.Fields) != 4 || ds1.Fields[3] != "name" {
+		PrintDataSet(&ds1)
+		t.Fatal()
+	}
+	PutDataSet(&ds1)
+	ds1, _ = ds.LeftJoin(&names, "code")
+	if ds1.Len() != 4 || ds1.Columns[3][3] != nil {
+		PrintDataSet(&ds1)
+		t.Fatal()
+	}
+	PutDataSet(&ds1)
+
+	// 5: Select, Distinct
+	ds1, err = ds.Select("code")
+	if err != nil || len(ds1.Columns) != 1 || ds1.Len() != 4 {
+		t.Fatal(err)
+	}
+	ds2, err := ds1.Distinct()
+	if err != nil || ds2.Len() != 3 {
+		PrintDataSet(&ds2)
+		t.Fatal(err)
+	}
+	PutDataSet(&ds2)
+	// columns of select are not shared
+	code := ds.Columns[ds.FieldI("code")][0]
+	PutDataSet(&ds1)
+	if ds.Len() != 4 || ds.Columns[ds.FieldI("code")][0] != code {
+		t.Fatal("select result shares columns")
+	}
+	if _, err = ds.Select("none"); err == nil {
+		t.Fatal("select field not found")
+	}
+}
+
+func TestDataSetCodec(t *testing.T) {
+	ds := NewDataSet([]string{"code", "price", "a_json"})
+	ds.AddRow([]interface{}{[]byte("a,1"), 1.25, []byte(`{"n":1}`)})
+	ds.AddRow([]interface{}{"b\"2", int64(3), nil})
+
+	// 1: json
+	src, err := json.Marshal(&ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(src) != `{"fields":["code","price","a_json"],"columns":[["a,1","b\"2"],[1.25,3],[{"n":1},null]]}` {
+		t.Fatal(string(src))
+	}
+	// by value, in a map or struct
+	val, err := json.Marshal(util.MapData{"data": ds, "s": struct{ D DataSet }{ds}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != `{"data":`+string(src)+`,"s":{"D":`+string(src)+`}}` {
+		t.Fatal(string(val))
+	}
+	src, _ = ds.MarshalJSONRows()
+	if string(src) != `[{"code":"a,1","price":1.25,"a_json":{"n":1}},{"code":"b\"2","price":3,"a_json":null}]` {
+		t.Fatal(string(src))
+	}
+	// NaN and Inf are null
+	nan := NewDataSet([]string{"v"})
+	nan.AddRow([]interface{}{math.NaN()})
+	nan.AddRow([]interface{}{math.Inf(1)})
+	if src, err = json.Marshal(&nan); err != nil || string(src) != `{"fields":["v"],"columns":[[null,null]]}` {
+		t.Fatal(string(src), err)
+	}
+	var ds1 DataSet
+	if err = json.Unmarshal([]byte(`{"fields":["code"],"columns":[["a","b"]]}`), &ds1); err != nil || ds1.Len() != 2 {
+		t.Fatal(err)
+	}
+
+	// 2: csv
+	buf := bytes.Buffer{}
+	opts := DefaultCSVOptions
+	opts.Decimal = 1
+	if err = ds.WriteCSV(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "code,price,a_json\n\"a,1\",1.2,\"{\"\"n\"\":1}\"\n\"b\"\"2\",3,\n" {
+		t.Fatal(buf.String())
+	}
+
+	// 3: binary
+	ds.Types = []ColType{{Name: "code", TypeName: "VARCHAR"}, {Name: "price"}, {Name: "a_json"}}
+	src, err = ds.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds1 = DataSet{}
+	if err = ds1.UnmarshalBinary(src); err != nil {
+		t.Fatal(err)
+	}
+	if ds1.Len() != 2 || string(ds1.Columns[0][0].([]byte)) != "a,1" || ds1.Columns[1][1].(int64) != 3 || ds1.Columns[2][1] != nil || ds1.Types[0].TypeName != "VARCHAR" {
+		PrintDataSet(&ds1)
+		t.Fatal()
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	src := "code,name,price,date\n" +
+		"000001,\"Ping An, Bank\",10.5,2021-01-04\n" +
+		"\n" +
+		"600000,\"Pu \"\"Fa\"\"\nBank\",9,2021-01-05\n" +
+		"600001,bad row\n" +
+		"600002,x,abc,2021-01-06\n"
+
+	ds, report, err := ReadCSV(strings.NewReader(src), CSVLoadOptions{HasFields: true, Infer: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// price column is inferred as string because of "abc"
+	if ds.Len() != 3 || ds.Columns[0][0].(string) != "000001" || ds.Columns[1][0].(string) != "Ping An, Bank" || ds.Columns[1][1].(string) != "Pu \"Fa\"\nBank" {
+		PrintDataSet(&ds)
+		t.Fatal()
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Line != 6 {
+		t.Fatal(report.Skipped)
+	}
+	if _, ok := ds.Columns[3][0].(time.Time); !ok {
+		t.Fatal(ds.Types[3])
+	}
+
+	ds, report, err = ReadCSV(strings.NewReader(src), CSVLoadOptions{HasFields: true, Types: map[string]string{"price": CSVFloat}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Len() != 2 || ds.Columns[2][1].(float64) != 9 || len(report.Skipped) != 2 || report.Skipped[1].Line != 7 {
+		PrintDataSet(&ds)
+		t.Fatal(report.Skipped)
+	}
+}
+
+func TestDBRowTypes(t *testing.T) {
+	dbRow := DBRow{Fields: []string{"a_json", "tags", "period", "price", "ok", "at", "empty"}}
+	dbRow.Values = []interface{}{
+		[]byte(`{"Name":"tom","Age":22}`),
+		[]byte(`"a"=>"1", "b c"=>NULL, "d"=>"x\"y"`),
+		[]byte(`[1,10)`),
+		[]byte("-12.345"),
+		[]byte("t"),
+		[]byte("2021-01-04 09:30:00+08"),
+		nil,
+	}
+
+	var u User
+	if err := dbRow.JSON("a_json", &u); err != nil || u.Name != "tom" || u.Age != 22 {
+		t.Fatal(err, u)
+	}
+	m, err := dbRow.MapData("tags")
+	if err != nil || m.String("a") != "1" || !m.IsNull("b c") || m.String("d") != `x"y` {
+		t.Fatal(err, m)
+	}
+	m, err = dbRow.MapData("a_json")
+	if err != nil || m.Int("Age") != 22 {
+		t.Fatal(err, m)
+	}
+	r, err := dbRow.Range("period")
+	if err != nil || r.Lower != "1" || r.Upper != "10" || !r.LowerInc || r.UpperInc {
+		t.Fatal(err, r)
+	}
+	r, err = Current().Driver.Range([]byte(`(,"2021-02-01 00:00:00"]`))
+	if err != nil || !r.LowerInf || r.Upper != "2021-02-01 00:00:00" || !r.UpperInc {
+		t.Fatal(err, r)
+	}
+	if v := dbRow.Decimal("price", 2); v != -1234 {
+		t.Fatal(v)
+	}
+	if !dbRow.Bool("ok") || !dbRow.NullBool("ok").Valid {
+		t.Fatal()
+	}
+	if at := dbRow.Time("at"); at.UTC().Hour() != 1 {
+		t.Fatal(at)
+	}
+	if !dbRow.IsNull("empty") || dbRow.NullInt64("empty").Valid || !dbRow.IsNull("none") {
+		t.Fatal()
+	}
+}
+
+func TestPostgresTime(t *testing.T) {
+	p := &Postgres{}
+	v, err := p.Time([]byte("13:04:05.5"))
+	if err != nil || v.Hour() != 13 || v.Nanosecond() != 500000000 || v.Year() != 0 {
+		t.Fatal(v, err)
+	}
+	v, err = p.Time([]byte("13:04:05+05:30"))
+	if _, offset := v.Zone(); err != nil || v.Hour() != 13 || offset != 5*3600+1800 {
+		t.Fatal(v, err)
+	}
+	v, err = p.Time([]byte("2020-01-02 13:04:05"))
+	if err != nil || v.Day() != 2 || v.Hour() != 13 {
+		t.Fatal(v, err)
+	}
+}
+
+func Test_Listen(t *testing.T) {
+	d := Current()
+	// Listen waits for the connection
+	if err := d.DB().Ping(); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan string, 1)
+	err := d.Listen("test01_changed", func(payload string) {
+		ch <- payload
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.CloseListener()
+
+	// 1: rollback, not delivered
+	tx, err := BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Notify("test01_changed", "rollback")
+	tx.Rollback()
+
+	// 2: commit
+	tx, _ = BeginTx()
+	if err = tx.Notify("test01_changed", "code10"); err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+
+	select {
+	case s := <-ch:
+		if s != "code10" {
+			t.Fatal(s)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("notification timeout")
+	}
+}
+
+func TestListenReconnect(t *testing.T) {
+	d := &Database{Name: "listen", Driver: &Postgres{}, log: log.NewEmpty()}
+	l := newListener(d)
+	l.listener = &pq.Listener{Notify: make(chan *pq.Notification, 1)}
+	d.listener = l
+	go l.run()
+	defer close(l.done)
+
+	ch := make(chan bool, 1)
+	d.OnListenReconnect(func() {
+		panic("recovered")
+	})
+	d.OnListenReconnect(func() {
+		ch <- true
+	})
+	l.listener.Notify <- nil
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("reconnect is not called")
+	}
+}
+
+func TestListenPending(t *testing.T) {
+	d := &Database{Name: "listen", Driver: &Postgres{}, log: log.NewEmpty()}
+	l := newListener(d)
+	d.listener = l
+	release := make(chan error)
+	l.listen = func(channel string) error {
+		return <-release
+	}
+
+	// timeout removes the handler of caller only
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 2)
+	go func() {
+		errs <- d.Listen("jobs", func(string) {})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := d.ListenContext(ctx, "jobs", func(string) {}); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if n := len(l.handlers["jobs"]); n != 1 {
+		t.Fatal(n)
+	}
+
+	// waiting Listen gets the error of the first Listen
+	go func() {
+		errs <- d.Listen("jobs", func(string) {})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	release <- errors.New("db is down")
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil || err.Error() != "db is down" {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := l.handlers["jobs"]; ok || len(l.pending) != 0 {
+		t.Fatal(l.handlers, l.pending)
+	}
+
+	go func() {
+		release <- nil
+	}()
+	if err := d.Listen("jobs", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Listen("jobs", func(string) {}); err != nil || len(l.handlers["jobs"]) != 2 {
+		t.Fatal(err, l.handlers)
+	}
+}
+
+func TestQueryCompose(t *testing.T) {
+	q := NewQuery("stocks")
+	q.Where("date=$2 and code=$1", "a001", 20210104).Order("date").Limit(10)
+	if str, args := q.ParseArgs(); str != "SELECT * FROM stocks WHERE date=$2 and code=$1 ORDER BY date LIMIT 10" || len(args) != 2 {
+		t.Fatal(str, args)
+	}
+
+	// sub query in where
+	sub := NewQuery("holdings")
+	sub.Select("code").Where("user_id=$1 and note<>'$1'", 7)
+	q = NewQuery("stocks")
+	q.Where("date>$1 and code IN $2 and price<$3", 20210101, &sub, 9.5)
+	str, args := q.ParseArgs()
+	if str != "SELECT * FROM stocks WHERE date>$1 and code IN (SELECT code FROM holdings WHERE user_id=$3 and note<>'$1') and price<$2" {
+		t.Fatal(str)
+	}
+	if len(args) != 3 || args[1].(float64) != 9.5 || args[2].(int) != 7 {
+		t.Fatal(args)
+	}
+
+	// cte, from sub query, union all
+	recent := NewQuery("prices")
+	recent.Where("date>$1", 20210101)
+	a := NewQuery("r")
+	a.Select("code, price").Where("code=$1", "a001")
+	b := NewQuery("r")
+	b.Select("code, price").Where("code=$1", "a002").Order("price desc").Limit(1)
+	a.With("r", &recent).UnionAll(&b).Order("price")
+	str, args = a.ParseArgs()
+	if str != "WITH r AS (SELECT * FROM prices WHERE date>$1) SELECT code, price FROM r WHERE code=$2 UNION ALL (SELECT code, price FROM r WHERE code=$3 ORDER BY price desc LIMIT 1) ORDER BY price" {
+		t.Fatal(str)
+	}
+	if len(args) != 3 || args[2].(string) != "a002" {
+		t.Fatal(args)
+	}
+
+	f := NewQuery("")
+	f.Select("count(1)").FromQuery(&recent, "t").Where("t.price>$1", 1)
+	if str, args = f.ParseArgs(); str != "SELECT count(1) FROM (SELECT * FROM prices WHERE date>$1) AS t WHERE t.price>$2" || len(args) != 2 {
+		t.Fatal(str, args)
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	keys := parseOrder(`a.date DESC, coalesce(b, 'x,y') asc,id`)
+	if len(keys) != 3 || keys[0] != (orderKey{"a.date", true}) || keys[1] != (orderKey{"coalesce(b, 'x,y')", false}) || keys[2] != (orderKey{"id", false}) {
+		t.Fatal(keys)
+	}
+}
+
+func TestConnectString(t *testing.T) {
+	host, hasHost := os.LookupEnv("GNO_TEST_HOST")
+	os.Setenv("GNO_TEST_HOST", "db.local")
+	defer func() {
+		if hasHost {
+			os.Setenv("GNO_TEST_HOST", host)
+		} else {
+			os.Unsetenv("GNO_TEST_HOST")
+		}
+	}()
+	f, err := ioutil.TempFile("", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("it's secret\n")
+	f.Close()
+
+	c := map[string]string{
+		"dbname":                     "app",
+		"user":                       "${GNO_TEST_USER}",
+		"password_file":              f.Name(),
+		"host":                       "${GNO_TEST_HOST}",
+		"sslmode":                    "verify-full",
+		"sslrootcert":                "/etc/ssl/root.crt",
+		"application_name":           "my app",
+		"statement_timeout":          "5000",
+		"param.target_session_attrs": "read-write",
+	}
+	password, err := confPassword(c)
+	if err != nil || password != "it's secret" {
+		t.Fatal(password, err)
+	}
+
+	p := &Postgres{DBName: confGet(c, "dbname", ""), User: confGet(c, "user", "postgres"), Password: password,
+		Host: confGet(c, "host", ""), SSLMode: confGet(c, "sslmode", ""), SSLRootCert: confGet(c, "sslrootcert", ""),
+		ApplicationName: confGet(c, "application_name", ""), StatementTimeout: confGet(c, "statement_timeout", ""),
+		Params: confParams(c)}
+	expected := `dbname=app password='it\'s secret' host=db.local port=5432 sslmode=verify-full sslrootcert=/etc/ssl/root.crt application_name='my app' statement_timeout=5000 target_session_attrs=read-write`
+	if s := p.ConnectString(); s != expected {
+		t.Fatal(s)
+	}
+
+	p = &Postgres{DBName: "app", User: "postgres", Password: "a$b"}
+	if s := p.ConnectString(); s != "dbname=app user=postgres password=a$b host=127.0.0.1 port=5432 sslmode=disable" {
+		t.Fatal(s)
+	}
+	if s := expandEnv("a$b${GNO_TEST_HOST}"); s != "a$bdb.local" {
+		t.Fatal(s)
+	}
+}
+
+func TestPasswordFileErr(t *testing.T) {
+	cur := Current()
+	d := New("password_file", map[string]string{"password_file": "/not/exists", "level": "none"})
+	dbpool.SetCurrent(cur)
+	delete(dbpool.dblist, d.Name)
+
+	if _, err := d.Connect(); err == nil || !strings.Contains(err.Error(), "password_file") {
+		t.Fatal(err)
+	}
+	if err := d.DB().Ping(); err == nil || !strings.Contains(err.Error(), "password_file") {
+		t.Fatal(err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	q := NewQuery("docs")
+	q.Where("status=$1", 1).Order("id desc").Limit(10)
+	q.Search([]string{"title", "body"}, " go sql ", SearchOptions{Config: "english", Rank: true})
+	sqlstr, args := q.ParseArgs()
+	expected := `SELECT * FROM docs WHERE (status=$1) AND to_tsvector('english', coalesce("title",'') || ' ' || coalesce("body",'')) @@ websearch_to_tsquery('english',$2) ORDER BY ts_rank(to_tsvector('english', coalesce("title",'') || ' ' || coalesce("body",'')), websearch_to_tsquery('english',$2)) DESC,id desc LIMIT 10`
+	if sqlstr != expected || len(args) != 2 || args[1] != "go sql" {
+		t.Fatal(sqlstr, args)
+	}
+
+	q = NewQuery("docs")
+	q.Search([]string{"title", "d.body"}, "go-sq", SearchOptions{Mode: SearchPrefix, Weights: []string{"A", "b"}})
+	sqlstr, args = q.ParseArgs()
+	expected = `SELECT * FROM docs WHERE setweight(to_tsvector('simple', coalesce("title",'')), 'A') || setweight(to_tsvector('simple', coalesce("d"."body",'')), 'B') @@ to_tsquery('simple',$1)`
+	if sqlstr != expected || args[0] != "go:* & sq:*" {
+		t.Fatal(sqlstr, args)
+	}
+
+	q = NewQuery("docs")
+	q.Search([]string{"title"}, "  ", SearchOptions{})
+	if sqlstr = q.Parse(); sqlstr != "SELECT * FROM docs" {
+		t.Fatal(sqlstr)
+	}
+
+	sqlstr, err := SearchIndexSQL("public.docs", []string{"title"}, SearchOptions{})
+	if err != nil || sqlstr != `CREATE INDEX IF NOT EXISTS "public_docs_search_idx" ON "public"."docs" USING GIN ((to_tsvector('simple', coalesce("title",''))))` {
+		t.Fatal(sqlstr, err)
+	}
+	if _, err = SearchIndexSQL("docs", []string{"title"}, SearchOptions{Config: "x'"}); err == nil {
+		t.Fatal("invalid config")
+	}
+	if _, err = SearchVector([]string{"title"}, SearchOptions{Config: "x'"}); err == nil {
+		t.Fatal("invalid config")
+	}
+
+	// invalid config is returned by Query
+	q = NewQuery("docs")
+	q.Search([]string{"title"}, "go", SearchOptions{Config: "english'); drop"})
+	if _, err := q.Query(); err == nil || !strings.Contains(err.Error(), "invalid text search config") {
+		t.Fatal(err)
+	}
+	outer := NewQuery("t")
+	outer.FromQuery(&q, "d")
+	if _, err := outer.Query(); err == nil {
+		t.Fatal("error of sub query")
+	}
+}
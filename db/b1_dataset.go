@@ -1,15 +1,10 @@
 package db
 
 import (
-	"bufio"
-	"bytes"
 	"database/sql"
 	"fmt"
-	"os"
 	"reflect"
-	"strings"
 
-	iconv "github.com/djimenez/iconv-go"
 	"github.com/kere/gno/libs/util"
 )
 
@@ -262,92 +257,14 @@ func (d *DataSet) EachPage(pageSize int, f func(page int, ds DataSet) bool) int
 	return n
 }
 
+// LoadCSV load csv file, all values are string
 func LoadCSV(filename string, hasFields bool) (DataSet, error) {
-	ds := DataSet{}
-	var err error
-	ds.Fields, ds.Columns, err = loadCSV(filename, hasFields, false)
+	ds, _, err := LoadCSVWithOptions(filename, CSVLoadOptions{HasFields: hasFields, TrimSpace: true})
 	return ds, err
 }
 
+// LoadCSVP load csv file, columns from pool
 func LoadCSVP(filename string, hasFields bool) (DataSet, error) {
-	ds := DataSet{}
-	var err error
-	ds.Fields, ds.Columns, err = loadCSV(filename, hasFields, true)
+	ds, _, err := LoadCSVWithOptions(filename, CSVLoadOptions{HasFields: hasFields, TrimSpace: true, IsPool: true})
 	return ds, err
 }
-
-func loadCSV(filename string, hasFields, isPool bool) ([]string, [][]interface{}, error) {
-	f, err := os.OpenFile(filename, os.O_RDONLY, os.ModePerm)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer f.Close()
-
-	sep := util.BComma
-	scanner := bufio.NewScanner(f)
-	scanner.Scan()
-	src := scanner.Bytes()
-	isGB := util.IsGBK(src)
-	toSrc := make([]byte, len(src)*2)
-	var wn int
-	if isGB {
-		_, wn, _ = iconv.Convert(src, toSrc, "gb2312", "utf-8")
-		src = toSrc[:wn]
-	}
-
-	var columns [][]interface{}
-	var fields []string
-
-	var ll int
-	if hasFields {
-		fields = strings.Split(string(src), util.SComma)
-		// fields = util.SplitStrNotSafe(util.Bytes2Str(src), util.SComma)
-		ll = len(fields)
-		columns = make([][]interface{}, ll)
-		if isPool {
-			for i := 0; i < ll; i++ {
-				columns[i] = GetColumn()
-			}
-		}
-	} else {
-		arr := util.SplitBytesNotSafe(src, sep)
-		// arr := bytes.Split(src, sep)
-		ll = len(arr)
-		fields = make([]string, ll)
-		columns = make([][]interface{}, ll)
-		for i := 0; i < ll; i++ {
-			if isPool {
-				columns[i] = GetColumn()
-			}
-			fields[i] = fmt.Sprint("val", i+1)
-			columns[i] = append(columns[i], string(bytes.TrimSpace(arr[i])))
-			// columns[i] = append(columns[i], bytes.TrimSpace(arr[i]))
-		}
-	}
-
-	for scanner.Scan() {
-		src := scanner.Bytes()
-		if len(src) == 0 {
-			continue
-		}
-		if isGB {
-			for i := 0; i < wn; i++ {
-				toSrc[i] = 0
-			}
-			_, wn, _ := iconv.Convert(src, toSrc, "gb2312", "utf-8")
-			src = toSrc[:wn]
-		}
-		// fmt.Println(string(src))
-		// arr := bytes.Split(src, sep)
-		arr := util.SplitBytesNotSafe(src, sep)
-		if len(arr) != ll {
-			continue
-		}
-
-		for k := 0; k < ll; k++ {
-			columns[k] = append(columns[k], string(bytes.TrimSpace(arr[k])))
-		}
-	}
-
-	return fields, columns, nil
-}
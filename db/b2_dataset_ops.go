@@ -0,0 +1,500 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kere/gno/libs/util"
+)
+
+const (
+	// AggCount count rows
+	AggCount = "count"
+	// AggSum sum values
+	AggSum = "sum"
+	// AggAvg average values
+	AggAvg = "avg"
+	// AggMin min value
+	AggMin = "min"
+	// AggMax max value
+	AggMax = "max"
+	// AggFirst first value
+	AggFirst = "first"
+	// AggLast last value
+	AggLast = "last"
+
+	sSortDesc = " desc"
+	sSortAsc  = " asc"
+	keySep    = "\x00"
+)
+
+// Aggregation for GroupBy
+// Field: source field, Func: AggSum..., As: result field name
+type Aggregation struct {
+	Field string
+	Func  string
+	As    string
+}
+
+// FieldI index of field, if not found, return -1
+func (d *DataSet) FieldI(field string) int {
+	return util.StringsI(field, d.Fields)
+}
+
+func (d *DataSet) fieldsI(fields []string) ([]int, error) {
+	n := len(fields)
+	arr := make([]int, n)
+	for i := 0; i < n; i++ {
+		arr[i] = d.FieldI(fields[i])
+		if arr[i] < 0 {
+			return nil, fmt.Errorf("dataset field %s not found", fields[i])
+		}
+	}
+	return arr, nil
+}
+
+func (d *DataSet) typesOf(index []int) []ColType {
+	if len(d.Types) == 0 {
+		return nil
+	}
+	n := len(index)
+	typs := make([]ColType, n)
+	for i := 0; i < n; i++ {
+		typs[i] = d.Types[index[i]]
+	}
+	return typs
+}
+
+// rowKey build a hashable key from columns at row i
+func (d *DataSet) rowKey(i int, index []int) string {
+	if len(index) == 1 {
+		return valueKey(d.Columns[index[0]][i])
+	}
+	buf := bytes.Buffer{}
+	for k, n := range index {
+		if k > 0 {
+			buf.WriteString(keySep)
+		}
+		buf.WriteString(valueKey(d.Columns[n][i]))
+	}
+	return buf.String()
+}
+
+// Filter rows by func, return pooled DataSet
+func (d *DataSet) Filter(f func(row DBRow) bool) DataSet {
+	l := d.Len()
+	n := len(d.Columns)
+	ds := GetDataSet(d.Fields)
+	ds.Types = d.Types
+	row := d.GetDBRow()
+	defer PutRow(row.Values)
+
+	for i := 0; i < l; i++ {
+		d.DBRowAt(i, row)
+		if !f(row) {
+			continue
+		}
+		for k := 0; k < n; k++ {
+			ds.Columns[k] = append(ds.Columns[k], d.Columns[k][i])
+		}
+	}
+	return ds
+}
+
+// Select fields, return pooled DataSet, the columns are copied from d
+func (d *DataSet) Select(fields ...string) (DataSet, error) {
+	index, err := d.fieldsI(fields)
+	if err != nil {
+		return EmptyDataSet, err
+	}
+	n := len(index)
+	ds := GetDataSet(fields)
+	ds.Types = d.typesOf(index)
+	for i := 0; i < n; i++ {
+		ds.Columns[i] = append(ds.Columns[i], d.Columns[index[i]]...)
+	}
+	return ds, nil
+}
+
+// Distinct rows by fields, keep the first row. if fields is empty, use all fields
+func (d *DataSet) Distinct(fields ...string) (DataSet, error) {
+	if len(fields) == 0 {
+		fields = d.Fields
+	}
+	index, err := d.fieldsI(fields)
+	if err != nil {
+		return EmptyDataSet, err
+	}
+
+	l := d.Len()
+	n := len(d.Columns)
+	ds := GetDataSet(d.Fields)
+	ds.Types = d.Types
+	exists := make(map[string]struct{}, l)
+	for i := 0; i < l; i++ {
+		key := d.rowKey(i, index)
+		if _, ok := exists[key]; ok {
+			continue
+		}
+		exists[key] = struct{}{}
+		for k := 0; k < n; k++ {
+			ds.Columns[k] = append(ds.Columns[k], d.Columns[k][i])
+		}
+	}
+	return ds, nil
+}
+
+// SortBy fields, sort in place
+// field: "price" or "price desc"
+func (d *DataSet) SortBy(fields ...string) error {
+	count := len(fields)
+	names := make([]string, count)
+	desc := make([]bool, count)
+	for i := 0; i < count; i++ {
+		name := strings.TrimSpace(fields[i])
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasSuffix(lower, sSortDesc):
+			name = strings.TrimSpace(name[:len(name)-len(sSortDesc)])
+			desc[i] = true
+		case strings.HasSuffix(lower, sSortAsc):
+			name = strings.TrimSpace(name[:len(name)-len(sSortAsc)])
+		}
+		names[i] = name
+	}
+	index, err := d.fieldsI(names)
+	if err != nil {
+		return err
+	}
+
+	l := d.Len()
+	order := util.GetInts(l)
+	defer util.PutInts(order)
+	for i := 0; i < l; i++ {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		for k := 0; k < count; k++ {
+			col := d.Columns[index[k]]
+			c := compareValue(col[order[a]], col[order[b]])
+			if c == 0 {
+				continue
+			}
+			if desc[k] {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	tem := GetColumn(l)
+	defer PutColumn(tem)
+	n := len(d.Columns)
+	for k := 0; k < n; k++ {
+		col := d.Columns[k]
+		for i := 0; i < l; i++ {
+			tem[i] = col[order[i]]
+		}
+		copy(col, tem)
+	}
+	return nil
+}
+
+// GroupBy field, return pooled DataSet
+// result fields: field, aggs[i].As
+func (d *DataSet) GroupBy(field string, aggs ...Aggregation) (DataSet, error) {
+	keyI := d.FieldI(field)
+	if keyI < 0 {
+		return EmptyDataSet, fmt.Errorf("dataset field %s not found", field)
+	}
+	n := len(aggs)
+	fields := make([]string, n+1)
+	fields[0] = field
+	index := make([]int, n)
+	for i := 0; i < n; i++ {
+		if aggs[i].Func == AggCount && aggs[i].Field == "" {
+			index[i] = keyI
+		} else if index[i] = d.FieldI(aggs[i].Field); index[i] < 0 {
+			return EmptyDataSet, fmt.Errorf("dataset field %s not found", aggs[i].Field)
+		}
+		fields[i+1] = aggs[i].As
+		if fields[i+1] == "" && aggs[i].Field == "" {
+			fields[i+1] = aggs[i].Func
+		} else if fields[i+1] == "" {
+			fields[i+1] = aggs[i].Func + "_" + aggs[i].Field
+		}
+	}
+
+	// group rows by key, keep the first appearance order
+	l := d.Len()
+	groups := make(map[string]int)
+	var rowsI [][]int
+	for i := 0; i < l; i++ {
+		key := valueKey(d.Columns[keyI][i])
+		g, ok := groups[key]
+		if !ok {
+			g = len(rowsI)
+			groups[key] = g
+			rowsI = append(rowsI, util.GetInts())
+		}
+		rowsI[g] = append(rowsI[g], i)
+	}
+
+	ds := GetDataSet(fields)
+	for g := range rowsI {
+		ds.Columns[0] = append(ds.Columns[0], d.Columns[keyI][rowsI[g][0]])
+		for k := 0; k < n; k++ {
+			v, err := aggregate(aggs[k].Func, d.Columns[index[k]], rowsI[g])
+			if err != nil {
+				PutDataSet(&ds)
+				return EmptyDataSet, err
+			}
+			ds.Columns[k+1] = append(ds.Columns[k+1], v)
+		}
+		util.PutInts(rowsI[g])
+	}
+	return ds, nil
+}
+
+func aggregate(fn string, col []interface{}, rows []int) (interface{}, error) {
+	count := len(rows)
+	switch fn {
+	case AggCount:
+		return int64(count), nil
+	case AggFirst:
+		return col[rows[0]], nil
+	case AggLast:
+		return col[rows[count-1]], nil
+	case AggSum, AggAvg:
+		var sum float64
+		for _, i := range rows {
+			sum += valueFloat(col[i])
+		}
+		if fn == AggAvg {
+			return sum / float64(count), nil
+		}
+		return sum, nil
+	case AggMin, AggMax:
+		v := col[rows[0]]
+		for _, i := range rows[1:] {
+			c := compareValue(col[i], v)
+			if (fn == AggMin && c < 0) || (fn == AggMax && c > 0) {
+				v = col[i]
+			}
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("dataset aggregation %s not supported", fn)
+}
+
+// Join inner join other DataSet on fields, return pooled DataSet
+// result fields: d.Fields + other.Fields without on fields
+func (d *DataSet) Join(other *DataSet, on ...string) (DataSet, error) {
+	return d.join(other, on, false)
+}
+
+// LeftJoin left join other DataSet on fields, return pooled DataSet
+func (d *DataSet) LeftJoin(other *DataSet, on ...string) (DataSet, error) {
+	return d.join(other, on, true)
+}
+
+func (d *DataSet) join(other *DataSet, on []string, isLeft bool) (DataSet, error) {
+	indexA, err := d.fieldsI(on)
+	if err != nil {
+		return EmptyDataSet, err
+	}
+	indexB, err := other.fieldsI(on)
+	if err != nil {
+		return EmptyDataSet, err
+	}
+
+	// other columns not in on
+	n := len(d.Fields)
+	fields := make([]string, n, n+len(other.Fields))
+	copy(fields, d.Fields)
+	var colsB []int
+	for i, name := range other.Fields {
+		if util.InStrings(name, on) {
+			continue
+		}
+		colsB = append(colsB, i)
+		fields = append(fields, name)
+	}
+
+	lb := other.Len()
+	hash := make(map[string][]int, lb)
+	for i := 0; i < lb; i++ {
+		key := other.rowKey(i, indexB)
+		hash[key] = append(hash[key], i)
+	}
+
+	ds := GetDataSet(fields)
+	if len(d.Types) > 0 && len(other.Types) > 0 {
+		ds.Types = append(append(ds.Types, d.Types...), other.typesOf(colsB)...)
+	}
+	m := len(colsB)
+	l := d.Len()
+	for i := 0; i < l; i++ {
+		matched := hash[d.rowKey(i, indexA)]
+		if len(matched) == 0 && !isLeft {
+			continue
+		}
+		if len(matched) == 0 {
+			for k := 0; k < n; k++ {
+				ds.Columns[k] = append(ds.Columns[k], d.Columns[k][i])
+			}
+			for k := 0; k < m; k++ {
+				ds.Columns[n+k] = append(ds.Columns[n+k], nil)
+			}
+			continue
+		}
+		for _, b := range matched {
+			for k := 0; k < n; k++ {
+				ds.Columns[k] = append(ds.Columns[k], d.Columns[k][i])
+			}
+			for k := 0; k < m; k++ {
+				ds.Columns[n+k] = append(ds.Columns[n+k], other.Columns[colsB[k]][b])
+			}
+		}
+	}
+	return ds, nil
+}
+
+// valueKey hashable key of value
+func valueKey(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case int:
+		return strconv.Itoa(val)
+	case time.Time:
+		return val.Format(DateTimeFormat)
+	}
+	return fmt.Sprint(v)
+}
+
+// compareValue return -1, 0, 1; nil is less than others
+func compareValue(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return 1
+	}
+
+	switch va := a.(type) {
+	case string:
+		if vb, ok := b.(string); ok {
+			return strings.Compare(va, vb)
+		}
+		if vb, ok := b.([]byte); ok {
+			return strings.Compare(va, util.Bytes2Str(vb))
+		}
+	case []byte:
+		if vb, ok := b.([]byte); ok {
+			return compareBytes(va, vb)
+		}
+		if vb, ok := b.(string); ok {
+			return compareBytes(va, util.Str2Bytes(vb))
+		}
+	case time.Time:
+		if vb, ok := b.(time.Time); ok {
+			switch {
+			case va.Before(vb):
+				return -1
+			case va.After(vb):
+				return 1
+			}
+			return 0
+		}
+	case int64, int, int32:
+		ia, _ := intValue(a)
+		if ib, ok := intValue(b); ok {
+			return compareInt(ia, ib)
+		}
+	case bool:
+		if vb, ok := b.(bool); ok {
+			switch {
+			case va == vb:
+				return 0
+			case !va:
+				return -1
+			}
+			return 1
+		}
+	}
+
+	fa, fb := valueFloat(a), valueFloat(b)
+	switch {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
+
+// intValue int64 of integer types
+func intValue(v interface{}) (int64, bool) {
+	switch val := v.(type) {
+	case int64:
+		return val, true
+	case int:
+		return int64(val), true
+	case int32:
+		return int64(val), true
+	}
+	return 0, false
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareBytes compare as number when both are numbers
+func compareBytes(a, b []byte) int {
+	if len(a) > 0 && len(b) > 0 && util.BytesNumType(a) == 'i' && util.BytesNumType(b) == 'i' {
+		ia, errA := strconv.ParseInt(util.Bytes2Str(a), 10, 64)
+		ib, errB := strconv.ParseInt(util.Bytes2Str(b), 10, 64)
+		if errA == nil && errB == nil {
+			return compareInt(ia, ib)
+		}
+	}
+	if isNumBytes(a) && isNumBytes(b) {
+		fa, _ := strconv.ParseFloat(util.Bytes2Str(a), 64)
+		fb, _ := strconv.ParseFloat(util.Bytes2Str(b), 64)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return bytes.Compare(a, b)
+}
+
+func isNumBytes(b []byte) bool {
+	return len(b) > 0 && util.BytesNumType(b) != 's'
+}
@@ -1,9 +1,14 @@
 package db
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kere/gno/libs/util"
 )
@@ -93,23 +98,31 @@ func (d *DBRow) Float(field string) float64 {
 
 // Float64At
 func (d *DBRow) FloatAt(i int) float64 {
-	typ := reflect.TypeOf(d.Values[i])
-	val := reflect.ValueOf(d.Values[i])
+	return valueFloat(d.Values[i])
+}
+
+// valueFloat convert value to float64
+func valueFloat(v interface{}) float64 {
+	if v == nil {
+		return 0
+	}
+	typ := reflect.TypeOf(v)
+	val := reflect.ValueOf(v)
 	switch typ.Kind() {
 	case reflect.Int64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
 		return float64(val.Int())
 	case reflect.Slice:
 		if typ.String() == "[]uint8" {
-			src := []byte(d.Values[i].([]uint8))
-			v, _ := strconv.ParseFloat(util.Bytes2Str(src), 64)
-			return v
+			src := []byte(v.([]uint8))
+			f, _ := strconv.ParseFloat(util.Bytes2Str(src), 64)
+			return f
 		}
 		return 0
 	case reflect.Float64, reflect.Float32:
 		return val.Float()
 	case reflect.String:
-		v, _ := strconv.ParseFloat(val.String(), 64)
-		return v
+		f, _ := strconv.ParseFloat(val.String(), 64)
+		return f
 	}
 	return 0
 }
@@ -181,3 +194,233 @@ func (d *DBRow) FloatsAt(i int) ([]float64, error) {
 func (d *DBRow) FloatsAtP(i int) ([]float64, error) {
 	return Current().Driver.FloatsP(d.Values[i].([]byte))
 }
+
+// Range postgres range type, Lower Upper are text of bounds
+type Range struct {
+	Lower    string
+	Upper    string
+	LowerInc bool
+	UpperInc bool
+	LowerInf bool
+	UpperInf bool
+	Empty    bool
+}
+
+// IsNull field is null or not exists
+func (d *DBRow) IsNull(field string) bool {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 {
+		return true
+	}
+	return d.Values[i] == nil
+}
+
+// IsNullAt
+func (d *DBRow) IsNullAt(i int) bool {
+	return d.Values[i] == nil
+}
+
+// Bool
+func (d *DBRow) Bool(field string) bool {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 {
+		return false
+	}
+	return d.BoolAt(i)
+}
+
+// BoolAt
+func (d *DBRow) BoolAt(i int) bool {
+	switch v := d.Values[i].(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case []byte:
+		b, _ := Current().Driver.Bool(v)
+		return b
+	case string:
+		b, _ := Current().Driver.Bool(util.Str2Bytes(v))
+		return b
+	}
+	return d.Int64At(i) != 0
+}
+
+// Time
+func (d *DBRow) Time(field string) time.Time {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 {
+		return time.Time{}
+	}
+	return d.TimeAt(i)
+}
+
+// TimeAt
+func (d *DBRow) TimeAt(i int) time.Time {
+	var t time.Time
+	switch v := d.Values[i].(type) {
+	case time.Time:
+		return v
+	case []byte:
+		t, _ = Current().Driver.Time(v)
+	case string:
+		t, _ = Current().Driver.Time(util.Str2Bytes(v))
+	}
+	return t
+}
+
+// Decimal numeric value * 10^scale, parsed from text without float rounding
+// 12.345 with scale 2 = 1234
+func (d *DBRow) Decimal(field string, scale int) int64 {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 {
+		return 0
+	}
+	return d.DecimalAt(i, scale)
+}
+
+// DecimalAt
+func (d *DBRow) DecimalAt(i, scale int) int64 {
+	var s string
+	switch v := d.Values[i].(type) {
+	case nil:
+		return 0
+	case []byte:
+		s = util.Bytes2Str(v)
+	case string:
+		s = v
+	case float64, float32:
+		s = strconv.FormatFloat(d.FloatAt(i), 'f', -1, 64)
+	default:
+		s = strconv.FormatInt(d.Int64At(i), 10)
+	}
+	n, _ := parseDecimal(s, scale)
+	return n
+}
+
+// parseDecimal 12.345 scale=2 -> 1234
+func parseDecimal(s string, scale int) (int64, error) {
+	s = strings.TrimSpace(s)
+	intPart, frac := s, ""
+	if k := strings.IndexByte(s, '.'); k > -1 {
+		intPart, frac = s[:k], s[k+1:]
+	}
+	if len(frac) > scale {
+		frac = frac[:scale]
+	}
+	frac += strings.Repeat("0", scale-len(frac))
+	return strconv.ParseInt(intPart+frac, 10, 64)
+}
+
+// NullInt64
+func (d *DBRow) NullInt64(field string) sql.NullInt64 {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 || d.Values[i] == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: d.Int64At(i), Valid: true}
+}
+
+// NullFloat64
+func (d *DBRow) NullFloat64(field string) sql.NullFloat64 {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 || d.Values[i] == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: d.FloatAt(i), Valid: true}
+}
+
+// NullString
+func (d *DBRow) NullString(field string) sql.NullString {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 || d.Values[i] == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: d.StringAt(i), Valid: true}
+}
+
+// NullBool
+func (d *DBRow) NullBool(field string) sql.NullBool {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 || d.Values[i] == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: d.BoolAt(i), Valid: true}
+}
+
+// NullTime
+func (d *DBRow) NullTime(field string) sql.NullTime {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 || d.Values[i] == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: d.TimeAt(i), Valid: true}
+}
+
+// JSON parse json, jsonb value to v
+func (d *DBRow) JSON(field string, v interface{}) error {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 {
+		return fmt.Errorf("field %s not found", field)
+	}
+	return d.JSONAt(i, v)
+}
+
+// JSONAt
+func (d *DBRow) JSONAt(i int, v interface{}) error {
+	switch val := d.Values[i].(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(val, v)
+	case string:
+		return json.Unmarshal(util.Str2Bytes(val), v)
+	}
+	src, err := json.Marshal(d.Values[i])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(src, v)
+}
+
+// MapData parse json object or hstore value
+func (d *DBRow) MapData(field string) (util.MapData, error) {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 {
+		return nil, fmt.Errorf("field %s not found", field)
+	}
+	return d.MapDataAt(i)
+}
+
+// MapDataAt
+func (d *DBRow) MapDataAt(i int) (util.MapData, error) {
+	if d.Values[i] == nil {
+		return nil, nil
+	}
+	src := d.BytesAt(i)
+	if len(bytes.TrimSpace(src)) == 0 {
+		return util.MapData{}, nil
+	}
+	if bytes.TrimSpace(src)[0] == '{' {
+		m := util.MapData{}
+		return m, json.Unmarshal(src, &m)
+	}
+	return Current().Driver.HStore(src)
+}
+
+// Range parse range value
+func (d *DBRow) Range(field string) (Range, error) {
+	i := util.StringsI(field, d.Fields)
+	if i < 0 {
+		return Range{}, fmt.Errorf("field %s not found", field)
+	}
+	return d.RangeAt(i)
+}
+
+// RangeAt
+func (d *DBRow) RangeAt(i int) (Range, error) {
+	if d.Values[i] == nil {
+		return Range{}, nil
+	}
+	return Current().Driver.Range(d.BytesAt(i))
+}
@@ -0,0 +1,368 @@
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kere/gno/libs/util"
+	"github.com/valyala/bytebufferpool"
+)
+
+const (
+	// JSONColumns {"fields":[...], "columns":[[...],[...]]}
+	JSONColumns = 0
+	// JSONRows [{"field":value,...},...]
+	JSONRows = 1
+
+	sJSONSuffix = "_json"
+)
+
+var (
+	bJSONFields  = []byte(`{"fields":`)
+	bJSONColumns = []byte(`,"columns":[`)
+	bJSONNull    = []byte("null")
+	bJSONTrue    = []byte("true")
+	bJSONFalse   = []byte("false")
+	bCRLF        = []byte("\r\n")
+)
+
+func init() {
+	gob.Register(time.Time{})
+}
+
+// CSVOptions for DataSet.WriteCSV
+type CSVOptions struct {
+	// Header write fields as the first line
+	Header bool
+	// Decimal float precision, -1: shortest
+	Decimal int
+	// Sep separator, default ','
+	Sep byte
+	// CRLF line break \r\n
+	CRLF bool
+	// TimeFormat default DTFormat
+	TimeFormat string
+}
+
+// DefaultCSVOptions header, shortest float
+var DefaultCSVOptions = CSVOptions{Header: true, Decimal: -1, Sep: ','}
+
+// MarshalJSON columnar json, DataSet and *DataSet are the same
+func (d DataSet) MarshalJSON() ([]byte, error) {
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+	if err := d.WriteJSON(buf, JSONColumns); err != nil {
+		return nil, err
+	}
+	src := make([]byte, buf.Len())
+	copy(src, buf.B)
+	return src, nil
+}
+
+// MarshalJSONRows row objects json
+func (d *DataSet) MarshalJSONRows() ([]byte, error) {
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+	if err := d.WriteJSON(buf, JSONRows); err != nil {
+		return nil, err
+	}
+	src := make([]byte, buf.Len())
+	copy(src, buf.B)
+	return src, nil
+}
+
+// UnmarshalJSON columnar json
+// json numbers are decoded to float64, strings to string
+func (d *DataSet) UnmarshalJSON(src []byte) error {
+	var dat struct {
+		Fields  []string        `json:"fields"`
+		Columns [][]interface{} `json:"columns"`
+	}
+	if err := json.Unmarshal(src, &dat); err != nil {
+		return err
+	}
+	if len(dat.Columns) != len(dat.Fields) {
+		return fmt.Errorf("dataset json: fields.Len()=%d != columns.Len()=%d", len(dat.Fields), len(dat.Columns))
+	}
+	d.Fields = dat.Fields
+	d.Columns = dat.Columns
+	d.Types = nil
+	return nil
+}
+
+// WriteJSON write json by mode: JSONColumns, JSONRows
+// []byte is written as string, field with suffix _json is written as raw json
+func (d *DataSet) WriteJSON(w io.Writer, mode int) error {
+	n := len(d.Fields)
+	l := d.Len()
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	isJSON := make([]bool, n)
+	for k := 0; k < n; k++ {
+		isJSON[k] = strings.HasSuffix(d.Fields[k], sJSONSuffix)
+	}
+
+	switch mode {
+	case JSONRows:
+		buf.WriteByte('[')
+		for i := 0; i < l; i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('{')
+			for k := 0; k < n; k++ {
+				if k > 0 {
+					buf.WriteByte(',')
+				}
+				writeJSONString(buf, d.Fields[k])
+				buf.WriteByte(':')
+				if err := writeJSONValue(buf, d.Columns[k][i], isJSON[k]); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(']')
+
+	default:
+		buf.Write(bJSONFields)
+		buf.WriteByte('[')
+		for k := 0; k < n; k++ {
+			if k > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, d.Fields[k])
+		}
+		buf.WriteByte(']')
+		buf.Write(bJSONColumns)
+		for k := 0; k < n; k++ {
+			if k > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('[')
+			col := d.Columns[k]
+			for i := 0; i < l; i++ {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := writeJSONValue(buf, col[i], isJSON[k]); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		}
+		buf.WriteString("]}")
+	}
+
+	_, err := w.Write(buf.B)
+	return err
+}
+
+func writeJSONString(buf *bytebufferpool.ByteBuffer, s string) {
+	src, _ := json.Marshal(s)
+	buf.Write(src)
+}
+
+func writeJSONValue(buf *bytebufferpool.ByteBuffer, v interface{}, isJSON bool) error {
+	switch val := v.(type) {
+	case nil:
+		buf.Write(bJSONNull)
+	case []byte:
+		if isJSON && json.Valid(val) {
+			buf.Write(val)
+			return nil
+		}
+		writeJSONString(buf, util.Bytes2Str(val))
+	case string:
+		writeJSONString(buf, val)
+	case int64:
+		buf.B = strconv.AppendInt(buf.B, val, 10)
+	case int:
+		buf.B = strconv.AppendInt(buf.B, int64(val), 10)
+	case float64:
+		writeJSONFloat(buf, val, 64)
+	case float32:
+		writeJSONFloat(buf, float64(val), 32)
+	case bool:
+		if val {
+			buf.Write(bJSONTrue)
+		} else {
+			buf.Write(bJSONFalse)
+		}
+	default:
+		src, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(src)
+	}
+	return nil
+}
+
+// writeJSONFloat NaN and Inf are null
+func writeJSONFloat(buf *bytebufferpool.ByteBuffer, f float64, bitSize int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		buf.Write(bJSONNull)
+		return
+	}
+	buf.B = strconv.AppendFloat(buf.B, f, 'f', -1, bitSize)
+}
+
+// WriteCSV write dataset as csv
+// fields contains separator, quote or line break are quoted
+func (d *DataSet) WriteCSV(w io.Writer, opts CSVOptions) error {
+	sep := opts.Sep
+	if sep == 0 {
+		sep = ','
+	}
+	lineBreak := util.BLineBreak
+	if opts.CRLF {
+		lineBreak = bCRLF
+	}
+	timeFormat := opts.TimeFormat
+	if timeFormat == "" {
+		timeFormat = DTFormat
+	}
+
+	n := len(d.Fields)
+	l := d.Len()
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	if opts.Header {
+		for k := 0; k < n; k++ {
+			if k > 0 {
+				buf.WriteByte(sep)
+			}
+			writeCSVField(buf, util.Str2Bytes(d.Fields[k]), sep)
+		}
+		buf.Write(lineBreak)
+	}
+
+	for i := 0; i < l; i++ {
+		for k := 0; k < n; k++ {
+			if k > 0 {
+				buf.WriteByte(sep)
+			}
+			switch val := d.Columns[k][i].(type) {
+			case nil:
+			case []byte:
+				writeCSVField(buf, val, sep)
+			case string:
+				writeCSVField(buf, util.Str2Bytes(val), sep)
+			case int64:
+				buf.B = strconv.AppendInt(buf.B, val, 10)
+			case int:
+				buf.B = strconv.AppendInt(buf.B, int64(val), 10)
+			case float64:
+				buf.WriteString(util.HumanFloat(val, opts.Decimal))
+			case float32:
+				buf.WriteString(util.HumanFloat(float64(val), opts.Decimal))
+			case time.Time:
+				buf.WriteString(val.Format(timeFormat))
+			default:
+				writeCSVField(buf, util.Str2Bytes(fmt.Sprint(val)), sep)
+			}
+		}
+		buf.Write(lineBreak)
+
+		// flush every 1000 rows
+		if i%1000 == 999 {
+			if _, err := w.Write(buf.B); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+	}
+
+	_, err := w.Write(buf.B)
+	return err
+}
+
+func writeCSVField(buf *bytebufferpool.ByteBuffer, src []byte, sep byte) {
+	if bytes.IndexByte(src, sep) == -1 && bytes.IndexByte(src, '"') == -1 && bytes.IndexByte(src, '\n') == -1 && bytes.IndexByte(src, '\r') == -1 {
+		buf.Write(src)
+		return
+	}
+	buf.WriteByte('"')
+	for _, c := range src {
+		if c == '"' {
+			buf.WriteByte('"')
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteByte('"')
+}
+
+// colTypeBin ColType without reflect.Type
+type colTypeBin struct {
+	Name      string
+	TypeName  string
+	LengthOK  bool
+	Length    int
+	DecimalOK bool
+	Precision int
+	Scale     int
+}
+
+type dataSetBin struct {
+	Fields  []string
+	Columns [][]interface{}
+	Types   []colTypeBin
+}
+
+// MarshalBinary gob encoding, for cache
+// ColType.Type is not encoded
+func (d DataSet) MarshalBinary() ([]byte, error) {
+	dat := dataSetBin{Fields: d.Fields, Columns: d.Columns}
+	n := len(d.Types)
+	if n > 0 {
+		dat.Types = make([]colTypeBin, n)
+		for i := 0; i < n; i++ {
+			t := d.Types[i]
+			dat.Types[i] = colTypeBin{Name: t.Name, TypeName: t.TypeName, LengthOK: t.LengthOK, Length: t.Length,
+				DecimalOK: t.DecimalOK, Precision: t.Precision, Scale: t.Scale}
+		}
+	}
+
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(&dat); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary gob decoding
+func (d *DataSet) UnmarshalBinary(src []byte) error {
+	var dat dataSetBin
+	if err := gob.NewDecoder(bytes.NewReader(src)).Decode(&dat); err != nil {
+		return err
+	}
+	d.Fields = dat.Fields
+	d.Columns = dat.Columns
+	if len(d.Columns) < len(d.Fields) {
+		// gob omits empty slices
+		cols := make([][]interface{}, len(d.Fields))
+		copy(cols, d.Columns)
+		d.Columns = cols
+	}
+	d.Types = nil
+	n := len(dat.Types)
+	if n > 0 {
+		d.Types = make([]ColType, n)
+		for i := 0; i < n; i++ {
+			t := dat.Types[i]
+			d.Types[i] = ColType{Name: t.Name, TypeName: t.TypeName, LengthOK: t.LengthOK, Length: t.Length,
+				DecimalOK: t.DecimalOK, Precision: t.Precision, Scale: t.Scale}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	iconv "github.com/djimenez/iconv-go"
+	"github.com/kere/gno/libs/util"
+)
+
+const (
+	// CSVString column type
+	CSVString = "string"
+	// CSVInt column type, int64
+	CSVInt = "int"
+	// CSVFloat column type, float64
+	CSVFloat = "float"
+	// CSVTime column type, time.Time
+	CSVTime = "time"
+	// CSVBool column type
+	CSVBool = "bool"
+
+	// CharsetAuto detect utf-8 and gbk
+	CharsetAuto = "auto"
+	// CharsetUTF8 utf-8
+	CharsetUTF8 = "utf-8"
+	// CharsetGBK gbk
+	CharsetGBK = "gbk"
+
+	csvPeekSize = 4096
+)
+
+var (
+	bUTF8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+	// CSVTimeFormats formats for time type
+	CSVTimeFormats = []string{DTFormat, "2006-01-02", "2006/01/02 15:04:05", "2006/01/02", time.RFC3339}
+
+	csvColTypes = map[string]ColType{
+		CSVString: {TypeName: "VARCHAR", Type: reflect.TypeOf("")},
+		CSVInt:    {TypeName: "INT8", Type: reflect.TypeOf(int64(0))},
+		CSVFloat:  {TypeName: "FLOAT8", Type: reflect.TypeOf(float64(0))},
+		CSVTime:   {TypeName: "TIMESTAMP", Type: reflect.TypeOf(time.Time{})},
+		CSVBool:   {TypeName: "BOOL", Type: reflect.TypeOf(false)},
+	}
+)
+
+// CSVLoadOptions for LoadCSVWithOptions
+type CSVLoadOptions struct {
+	// HasFields the first record is fields
+	HasFields bool
+	// Sep separator, default ','
+	Sep byte
+	// Quote quote char, default '"'
+	Quote byte
+	// NoQuote disable quoting
+	NoQuote bool
+	// TrimSpace trim fields
+	TrimSpace bool
+	// Charset auto, utf-8, gbk, or any iconv charset. default auto
+	Charset string
+	// Types field: CSVInt ... the others are inferred if Infer, or string
+	Types map[string]string
+	// Infer int/float/time/string column type
+	Infer bool
+	// TimeFormats default CSVTimeFormats
+	TimeFormats []string
+	// IsPool columns from pool
+	IsPool bool
+}
+
+// CSVSkipRow skipped row
+type CSVSkipRow struct {
+	Line   int
+	Reason string
+}
+
+// CSVReport load report
+type CSVReport struct {
+	Charset string
+	Rows    int
+	Skipped []CSVSkipRow
+}
+
+// LoadCSVWithOptions load csv file
+func LoadCSVWithOptions(filename string, opts CSVLoadOptions) (DataSet, CSVReport, error) {
+	f, err := os.OpenFile(filename, os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return EmptyDataSet, CSVReport{}, err
+	}
+	defer f.Close()
+	return ReadCSV(f, opts)
+}
+
+// ReadCSV load csv from reader
+func ReadCSV(r io.Reader, opts CSVLoadOptions) (DataSet, CSVReport, error) {
+	var report CSVReport
+	src, charset, err := csvDecodeReader(r, opts.Charset)
+	if err != nil {
+		return EmptyDataSet, report, err
+	}
+	report.Charset = charset
+
+	if opts.Sep == 0 {
+		opts.Sep = ','
+	}
+	if opts.Quote == 0 {
+		opts.Quote = '"'
+	}
+	if opts.NoQuote {
+		opts.Quote = 0
+	}
+	cr := csvReader{r: bufio.NewReader(src), sep: opts.Sep, quote: opts.Quote, trim: opts.TrimSpace}
+
+	var ds DataSet
+	var lines []int
+	for {
+		record, line, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ds, report, fmt.Errorf("csv line %d: %s", line, err.Error())
+		}
+
+		if ds.Fields == nil {
+			n := len(record)
+			ds.Fields = make([]string, n)
+			ds.Columns = make([][]interface{}, n)
+			for i := 0; i < n; i++ {
+				if opts.IsPool {
+					ds.Columns[i] = GetColumn()
+				}
+				if opts.HasFields {
+					ds.Fields[i] = record[i]
+				} else {
+					ds.Fields[i] = fmt.Sprint("val", i+1)
+				}
+			}
+			if opts.HasFields {
+				continue
+			}
+		}
+
+		n := len(ds.Fields)
+		if len(record) != n {
+			report.Skipped = append(report.Skipped, CSVSkipRow{Line: line, Reason: fmt.Sprintf("expected %d fields, got %d", n, len(record))})
+			continue
+		}
+		for i := 0; i < n; i++ {
+			ds.Columns[i] = append(ds.Columns[i], record[i])
+		}
+		lines = append(lines, line)
+	}
+
+	if opts.Infer || len(opts.Types) > 0 {
+		csvConvertColumns(&ds, lines, opts, &report)
+	}
+	report.Rows = ds.Len()
+	return ds, report, nil
+}
+
+// csvDecodeReader detect charset and convert to utf-8
+func csvDecodeReader(r io.Reader, charset string) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, csvPeekSize)
+	head, _ := br.Peek(csvPeekSize)
+	if bytes.HasPrefix(head, bUTF8BOM) {
+		br.Discard(len(bUTF8BOM))
+		return br, CharsetUTF8, nil
+	}
+
+	charset = strings.ToLower(charset)
+	if charset == "" || charset == CharsetAuto {
+		charset = CharsetUTF8
+		// cut the last partial line
+		if len(head) == csvPeekSize {
+			if i := bytes.LastIndexByte(head, '\n'); i > 0 {
+				head = head[:i]
+			}
+		}
+		if !utf8.Valid(head) && util.IsGBK(head) {
+			charset = CharsetGBK
+		}
+	}
+
+	switch charset {
+	case CharsetUTF8, "utf8":
+		return br, CharsetUTF8, nil
+	}
+	cr, err := iconv.NewReader(br, charset, CharsetUTF8)
+	if err != nil {
+		return nil, charset, err
+	}
+	return cr, charset, nil
+}
+
+// csvConvertColumns convert string columns to typed columns
+func csvConvertColumns(ds *DataSet, lines []int, opts CSVLoadOptions, report *CSVReport) {
+	timeFormats := opts.TimeFormats
+	if len(timeFormats) == 0 {
+		timeFormats = CSVTimeFormats
+	}
+
+	n := len(ds.Fields)
+	typs := make([]string, n)
+	ds.Types = make([]ColType, n)
+	for k := 0; k < n; k++ {
+		typ, ok := opts.Types[ds.Fields[k]]
+		if !ok && opts.Infer {
+			typ = csvInferType(ds.Columns[k], timeFormats)
+		}
+		if _, ok = csvColTypes[typ]; !ok {
+			typ = CSVString
+		}
+		typs[k] = typ
+		ds.Types[k] = csvColTypes[typ]
+		ds.Types[k].Name = ds.Fields[k]
+	}
+
+	l := ds.Len()
+	skip := make([]bool, l)
+	skipN := 0
+	for k := 0; k < n; k++ {
+		if typs[k] == CSVString {
+			continue
+		}
+		col := ds.Columns[k]
+		for i := 0; i < l; i++ {
+			if skip[i] {
+				continue
+			}
+			v, err := csvParseValue(col[i].(string), typs[k], timeFormats)
+			if err != nil {
+				skip[i] = true
+				skipN++
+				report.Skipped = append(report.Skipped, CSVSkipRow{Line: lines[i],
+					Reason: fmt.Sprintf("field %s: %s", ds.Fields[k], err.Error())})
+				continue
+			}
+			col[i] = v
+		}
+	}
+	if skipN == 0 {
+		return
+	}
+
+	// remove skipped rows
+	for k := 0; k < n; k++ {
+		col := ds.Columns[k]
+		j := 0
+		for i := 0; i < l; i++ {
+			if skip[i] {
+				continue
+			}
+			col[j] = col[i]
+			j++
+		}
+		ds.Columns[k] = col[:j]
+	}
+}
+
+func csvParseValue(s, typ string, timeFormats []string) (interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	switch typ {
+	case CSVInt:
+		return strconv.ParseInt(s, 10, 64)
+	case CSVFloat:
+		return strconv.ParseFloat(s, 64)
+	case CSVBool:
+		return strconv.ParseBool(s)
+	case CSVTime:
+		for _, format := range timeFormats {
+			if t, err := time.ParseInLocation(format, s, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("can not parse %s to time", s)
+	}
+	return s, nil
+}
+
+// csvInferType int, float, time or string
+// numbers with leading zero, like stock code 000001, are strings
+func csvInferType(col []interface{}, timeFormats []string) string {
+	typ := ""
+	for _, v := range col {
+		s := v.(string)
+		if s == "" {
+			continue
+		}
+		var t string
+		switch util.StrNumType(s) {
+		case 'i':
+			t = CSVInt
+			if len(s) > 1 && s[0] == '0' {
+				return CSVString
+			}
+		case 'f':
+			t = CSVFloat
+			if len(s) > 1 && s[0] == '0' && s[1] != '.' {
+				return CSVString
+			}
+		default:
+			if _, err := csvParseValue(s, CSVTime, timeFormats); err != nil {
+				return CSVString
+			}
+			t = CSVTime
+		}
+
+		switch {
+		case typ == "" || typ == t:
+			typ = t
+		case typ == CSVInt && t == CSVFloat, typ == CSVFloat && t == CSVInt:
+			typ = CSVFloat
+		default:
+			return CSVString
+		}
+	}
+	if typ == "" {
+		return CSVString
+	}
+	return typ
+}
+
+// csvReader RFC 4180 reader, count line number
+type csvReader struct {
+	r     *bufio.Reader
+	sep   byte
+	quote byte
+	trim  bool
+	line  int
+	field []byte
+}
+
+// Read record, return the start line number. empty lines are skipped
+func (c *csvReader) Read() ([]string, int, error) {
+	var src []byte
+	var err error
+	for {
+		src, err = c.readLine()
+		if len(src) == 0 && err != nil {
+			return nil, c.line, err
+		}
+		if len(src) > 0 {
+			break
+		}
+	}
+	start := c.line
+
+	var record []string
+	inQuote, quoted := false, false
+	c.field = c.field[:0]
+	for {
+		l := len(src)
+		for i := 0; i < l; i++ {
+			b := src[i]
+			switch {
+			case inQuote && b == c.quote:
+				if i+1 < l && src[i+1] == c.quote {
+					c.field = append(c.field, b)
+					i++
+				} else {
+					inQuote = false
+				}
+			case inQuote:
+				c.field = append(c.field, b)
+			case b == c.sep:
+				record = append(record, c.fieldString(quoted))
+				c.field = c.field[:0]
+				quoted = false
+			case c.quote != 0 && b == c.quote && len(bytes.TrimSpace(c.field)) == 0 && !quoted:
+				c.field = c.field[:0]
+				inQuote, quoted = true, true
+			default:
+				c.field = append(c.field, b)
+			}
+		}
+		if !inQuote {
+			break
+		}
+
+		// quoted field contains line break
+		if err != nil {
+			return record, start, fmt.Errorf("extraneous or missing %q in quoted-field", c.quote)
+		}
+		c.field = append(c.field, '\n')
+		src, err = c.readLine()
+		if len(src) == 0 && err != nil {
+			return record, start, fmt.Errorf("extraneous or missing %q in quoted-field", c.quote)
+		}
+	}
+	record = append(record, c.fieldString(quoted))
+	return record, start, nil
+}
+
+func (c *csvReader) fieldString(quoted bool) string {
+	if c.trim && !quoted {
+		return string(bytes.TrimSpace(c.field))
+	}
+	return string(c.field)
+}
+
+// readLine without \r\n
+func (c *csvReader) readLine() ([]byte, error) {
+	src, err := c.r.ReadBytes('\n')
+	if len(src) > 0 || err == nil {
+		c.line++
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	src = bytes.TrimSuffix(src, util.BLineBreak)
+	src = bytes.TrimSuffix(src, []byte{'\r'})
+	if len(src) == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	return src, err
+}
@@ -0,0 +1,421 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kere/gno/libs/util"
+)
+
+const (
+	// KindAny interface{} column
+	KindAny = 0
+	// KindFloat float64 column
+	KindFloat = 1
+	// KindInt int64 column
+	KindInt = 2
+	// KindString string column
+	KindString = 3
+	// KindTime time.Time column
+	KindTime = 4
+)
+
+var (
+	typeFloat  = reflect.TypeOf(float64(0))
+	typeInt    = reflect.TypeOf(int64(0))
+	typeString = reflect.TypeOf("")
+	typeTime   = reflect.TypeOf(time.Time{})
+)
+
+// Kind of typed column by database type name, numeric is stored as float64.
+// money is string, postgres formats it by lc_monetary: $1,234.56
+func (c ColType) Kind() int {
+	switch strings.ToUpper(c.TypeName) {
+	case "FLOAT4", "FLOAT8", "NUMERIC", "DECIMAL", "FLOAT", "DOUBLE", "REAL":
+		return KindFloat
+	case "INT2", "INT4", "INT8", "SMALLINT", "INT", "INTEGER", "BIGINT", "TINYINT", "MEDIUMINT":
+		return KindInt
+	case "VARCHAR", "TEXT", "BPCHAR", "CHAR", "NAME", "UUID", "CITEXT", "MONEY":
+		return KindString
+	case "TIMESTAMP", "TIMESTAMPTZ", "DATE", "DATETIME":
+		return KindTime
+	}
+	switch c.Type {
+	case typeFloat:
+		return KindFloat
+	case typeInt:
+		return KindInt
+	case typeString:
+		return KindString
+	case typeTime:
+		return KindTime
+	}
+	return KindAny
+}
+
+// TypedColumn values are stored in the slice of Kind
+type TypedColumn struct {
+	Kind    int
+	Floats  []float64
+	Ints    []int64
+	Strings []string
+	Times   []time.Time
+	Values  []interface{}
+	// Nulls nil if there is no null value
+	Nulls []bool
+}
+
+// Len of column
+func (c *TypedColumn) Len() int {
+	switch c.Kind {
+	case KindFloat:
+		return len(c.Floats)
+	case KindInt:
+		return len(c.Ints)
+	case KindString:
+		return len(c.Strings)
+	case KindTime:
+		return len(c.Times)
+	}
+	return len(c.Values)
+}
+
+// IsNull value at i
+func (c *TypedColumn) IsNull(i int) bool {
+	return c.Nulls != nil && c.Nulls[i]
+}
+
+// Value boxed value at i, nil if null
+func (c *TypedColumn) Value(i int) interface{} {
+	if c.IsNull(i) {
+		return nil
+	}
+	switch c.Kind {
+	case KindFloat:
+		return c.Floats[i]
+	case KindInt:
+		return c.Ints[i]
+	case KindString:
+		return c.Strings[i]
+	case KindTime:
+		return c.Times[i]
+	}
+	return c.Values[i]
+}
+
+// setNull mark the last value as null
+func (c *TypedColumn) setNull(isNull bool) {
+	if c.Nulls == nil {
+		if !isNull {
+			return
+		}
+		c.Nulls = make([]bool, c.Len())
+	} else {
+		c.Nulls = append(c.Nulls, false)
+	}
+	c.Nulls[len(c.Nulls)-1] = isNull
+}
+
+// TypedDataSet column-typed DataSet, values of numeric columns are not boxed
+type TypedDataSet struct {
+	Fields  []string
+	Columns []TypedColumn
+	Types   []ColType
+}
+
+// Len rows
+func (d *TypedDataSet) Len() int {
+	if len(d.Columns) == 0 {
+		return 0
+	}
+	return d.Columns[0].Len()
+}
+
+// FieldI index of field
+func (d *TypedDataSet) FieldI(field string) int {
+	return util.StringsI(field, d.Fields)
+}
+
+// Column by field, nil if not found
+func (d *TypedDataSet) Column(field string) *TypedColumn {
+	i := d.FieldI(field)
+	if i < 0 {
+		return nil
+	}
+	return &d.Columns[i]
+}
+
+// Floats column, zero-copy, nil if field is not a float column
+func (d *TypedDataSet) Floats(field string) []float64 {
+	if c := d.Column(field); c != nil {
+		return c.Floats
+	}
+	return nil
+}
+
+// Ints column, zero-copy
+func (d *TypedDataSet) Ints(field string) []int64 {
+	if c := d.Column(field); c != nil {
+		return c.Ints
+	}
+	return nil
+}
+
+// Strings column, zero-copy
+func (d *TypedDataSet) Strings(field string) []string {
+	if c := d.Column(field); c != nil {
+		return c.Strings
+	}
+	return nil
+}
+
+// Times column, zero-copy
+func (d *TypedDataSet) Times(field string) []time.Time {
+	if c := d.Column(field); c != nil {
+		return c.Times
+	}
+	return nil
+}
+
+// DataSet convert to DataSet, values are boxed
+func (d *TypedDataSet) DataSet() DataSet {
+	n := len(d.Columns)
+	l := d.Len()
+	ds := DataSet{Fields: d.Fields, Columns: make([][]interface{}, n), Types: d.Types}
+	for k := 0; k < n; k++ {
+		col := make([]interface{}, l)
+		c := &d.Columns[k]
+		for i := 0; i < l; i++ {
+			col[i] = c.Value(i)
+		}
+		ds.Columns[k] = col
+	}
+	return ds
+}
+
+// Release typed dataset
+func (d *TypedDataSet) Release() {
+	d.Fields = nil
+	d.Columns = nil
+	d.Types = nil
+}
+
+// PutTypedDataSet float and int columns into pool
+func PutTypedDataSet(d *TypedDataSet) {
+	if d == nil {
+		return
+	}
+	for i := range d.Columns {
+		util.PutFloats(d.Columns[i].Floats)
+		util.PutInt64s(d.Columns[i].Ints)
+	}
+	d.Release()
+}
+
+// NewTypedDataSet convert DataSet, kinds are chosen from Types,
+// or from the first not null value if Types is empty
+func NewTypedDataSet(ds *DataSet) TypedDataSet {
+	n := len(ds.Columns)
+	l := ds.Len()
+	d := TypedDataSet{Fields: ds.Fields, Columns: make([]TypedColumn, n), Types: ds.Types}
+	row := DBRow{Values: make([]interface{}, 1)}
+	for k := 0; k < n; k++ {
+		var kind int
+		if len(ds.Types) == n {
+			kind = ds.Types[k].Kind()
+		} else {
+			kind = valueKind(ds.Columns[k])
+		}
+		c := newTypedColumn(kind, l, false)
+		for i := 0; i < l; i++ {
+			v := ds.Columns[k][i]
+			row.Values[0] = v
+			switch c.Kind {
+			case KindFloat:
+				c.Floats = append(c.Floats, valueFloat(v))
+			case KindInt:
+				if v == nil {
+					c.Ints = append(c.Ints, 0)
+				} else {
+					c.Ints = append(c.Ints, row.Int64At(0))
+				}
+			case KindString:
+				if v == nil {
+					c.Strings = append(c.Strings, "")
+				} else {
+					// copy bytes
+					c.Strings = append(c.Strings, string(row.BytesAt(0)))
+				}
+			case KindTime:
+				c.Times = append(c.Times, row.TimeAt(0))
+			default:
+				c.Values = append(c.Values, v)
+			}
+			c.setNull(v == nil)
+		}
+		d.Columns[k] = c
+	}
+	return d
+}
+
+func valueKind(col []interface{}) int {
+	for _, v := range col {
+		switch v.(type) {
+		case nil:
+			continue
+		case float64, float32:
+			return KindFloat
+		case int64, int, int32, int16, int8:
+			return KindInt
+		case string:
+			return KindString
+		case time.Time:
+			return KindTime
+		}
+		return KindAny
+	}
+	return KindAny
+}
+
+func newTypedColumn(kind, capN int, isPool bool) TypedColumn {
+	c := TypedColumn{Kind: kind}
+	switch kind {
+	case KindFloat:
+		if isPool {
+			c.Floats = util.GetFloats(0, capN)
+		} else {
+			c.Floats = make([]float64, 0, capN)
+		}
+	case KindInt:
+		if isPool {
+			c.Ints = util.GetInt64s(0, capN)
+		} else {
+			c.Ints = make([]int64, 0, capN)
+		}
+	case KindString:
+		c.Strings = make([]string, 0, capN)
+	case KindTime:
+		c.Times = make([]time.Time, 0, capN)
+	default:
+		c.Values = make([]interface{}, 0, capN)
+	}
+	return c
+}
+
+// ScanToTypedDataSet scan rows into typed columns directly
+func ScanToTypedDataSet(rows *sql.Rows, isPool bool) (TypedDataSet, error) {
+	typs, err := rows.ColumnTypes()
+	if err != nil {
+		return TypedDataSet{}, err
+	}
+
+	n := len(typs)
+	d := TypedDataSet{Fields: make([]string, n), Columns: make([]TypedColumn, n), Types: make([]ColType, n)}
+	dest := make([]interface{}, n)
+	for k := 0; k < n; k++ {
+		d.Types[k] = NewColType(typs[k])
+		d.Fields[k] = typs[k].Name()
+		d.Columns[k] = newTypedColumn(d.Types[k].Kind(), 100, isPool)
+		switch d.Columns[k].Kind {
+		case KindFloat:
+			dest[k] = &sql.NullFloat64{}
+		case KindInt:
+			dest[k] = &sql.NullInt64{}
+		case KindString:
+			dest[k] = &sql.NullString{}
+		case KindTime:
+			dest[k] = &sql.NullTime{}
+		default:
+			dest[k] = new(interface{})
+		}
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return d, err
+		}
+		for k := 0; k < n; k++ {
+			c := &d.Columns[k]
+			switch v := dest[k].(type) {
+			case *sql.NullFloat64:
+				c.Floats = append(c.Floats, v.Float64)
+				c.setNull(!v.Valid)
+			case *sql.NullInt64:
+				c.Ints = append(c.Ints, v.Int64)
+				c.setNull(!v.Valid)
+			case *sql.NullString:
+				c.Strings = append(c.Strings, v.String)
+				c.setNull(!v.Valid)
+			case *sql.NullTime:
+				c.Times = append(c.Times, v.Time)
+				c.setNull(!v.Valid)
+			case *interface{}:
+				val := *v
+				// driver bytes are reused by next scan
+				if b, ok := val.([]byte); ok {
+					val = append([]byte(nil), b...)
+				}
+				c.Values = append(c.Values, val)
+				c.setNull(val == nil)
+			}
+		}
+	}
+
+	return d, rows.Err()
+}
+
+// cQueryTyped db tx
+func (b *Builder) cQueryTyped(isPool bool, sqlstr string, args []interface{}) (TypedDataSet, error) {
+	if b.searchPath != "" && !b.isTx {
+		var d TypedDataSet
+		err := b.inTenantTx(func(tb *Builder) (err error) {
+			d, err = tb.cQueryTyped(isPool, sqlstr, args)
+			return err
+		})
+		return d, err
+	}
+
+	if stats := b.GetDatabase().getStats(); stats != nil {
+		now := time.Now()
+		d, err := b.queryTyped(isPool, sqlstr, args)
+		stats.record(sqlstr, time.Since(now), int64(d.Len()), err)
+		return d, err
+	}
+	return b.queryTyped(isPool, sqlstr, args)
+}
+
+func (b *Builder) queryTyped(isPool bool, sqlstr string, args []interface{}) (TypedDataSet, error) {
+	var err error
+	var rows *sql.Rows
+	if b.isTx {
+		rows, err = b.tx.Query(sqlstr, args...)
+	} else {
+		rows, err = b.GetDatabase().DB().Query(sqlstr, args...)
+	}
+	if err != nil {
+		return TypedDataSet{}, err
+	}
+	defer rows.Close()
+
+	return ScanToTypedDataSet(rows, isPool)
+}
+
+// QueryTyped return TypedDataSet
+func (q *QueryBuilder) QueryTyped() (TypedDataSet, error) {
+	if err := q.buildErr(); err != nil {
+		return TypedDataSet{}, err
+	}
+	sqlstr, args := q.ParseArgs()
+	return q.cQueryTyped(false, sqlstr, args)
+}
+
+// QueryTypedP return TypedDataSet, float and int columns are from pool, PutTypedDataSet after used
+func (q *QueryBuilder) QueryTypedP() (TypedDataSet, error) {
+	if err := q.buildErr(); err != nil {
+		return TypedDataSet{}, err
+	}
+	sqlstr, args := q.ParseArgs()
+	return q.cQueryTyped(true, sqlstr, args)
+}
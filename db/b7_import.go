@@ -0,0 +1,474 @@
+package db
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	sSQLTableColumns = "SELECT column_name, data_type, is_nullable='YES', coalesce(character_maximum_length, 0), column_default IS NOT NULL FROM information_schema.columns WHERE table_name=$1 AND table_schema="
+
+	defaultImportBatch = 500
+)
+
+// TableColumn schema of table column
+type TableColumn struct {
+	Name       string
+	DataType   string
+	Nullable   bool
+	MaxLength  int
+	HasDefault bool
+}
+
+// TableColumns schema introspection by information_schema, table: name or schema.name
+func (d *Database) TableColumns(table string) ([]TableColumn, error) {
+	args := []interface{}{table}
+	sqlstr := sSQLTableColumns + "current_schema()"
+	if i := strings.IndexByte(table, '.'); i > 0 {
+		args = []interface{}{table[i+1:], table[:i]}
+		sqlstr = sSQLTableColumns + "$2"
+	}
+	sqlstr += " ORDER BY ordinal_position"
+
+	b := d.NewBuilder("")
+	ds, err := b.cQuery(false, sqlstr, args)
+	if err != nil {
+		return nil, err
+	}
+	l := ds.Len()
+	if l == 0 {
+		return nil, errors.New("table " + table + " is not found")
+	}
+	cols := make([]TableColumn, l)
+	row := ds.GetDBRow()
+	defer PutRow(row.Values)
+	for i := 0; i < l; i++ {
+		ds.DBRowAt(i, row)
+		cols[i] = TableColumn{Name: row.StringAt(0), DataType: row.StringAt(1), Nullable: row.BoolAt(2),
+			MaxLength: row.IntAt(3), HasDefault: row.BoolAt(4)}
+	}
+	return cols, nil
+}
+
+// ImportOptions csv import
+type ImportOptions struct {
+	// CSV Sep, Quote, Charset, TrimSpace, TimeFormats are used, the first record is header
+	CSV CSVLoadOptions
+	// Mapping csv header: table column, "-" to ignore.
+	// Headers not in Mapping are matched to columns by name, case and spaces are ignored.
+	Mapping map[string]string
+	// BatchSize rows per insert, default 500
+	BatchSize int
+	// InTx all rows are inserted in one transaction, any insert error rollbacks all.
+	// Otherwise each batch is committed, rows of a failed batch are retried one by one.
+	InTx bool
+	// MaxErrors stop when rejected rows > MaxErrors, 0: no limit
+	MaxErrors int
+}
+
+// ImportRejected rejected csv row
+type ImportRejected struct {
+	Line   int
+	Record []string
+	Reason string
+}
+
+// ImportResult of csv import
+type ImportResult struct {
+	Header   []string
+	Columns  []string
+	Ignored  []string
+	Rows     int
+	Inserted int
+	Rejected []ImportRejected
+}
+
+// WriteReport rejected rows as csv: line, reason, original fields
+func (r *ImportResult) WriteReport(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := append([]string{"line", "reason"}, r.Header...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, item := range r.Rejected {
+		rec := append([]string{strconv.Itoa(item.Line), item.Reason}, item.Record...)
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteReportFile rejected rows csv file
+func (r *ImportResult) WriteReportFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.WriteReport(f)
+}
+
+// ImportCSV import csv file into table
+func (d *Database) ImportCSV(table, filename string, opts ImportOptions) (ImportResult, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer f.Close()
+	return d.ImportCSVReader(table, f, opts)
+}
+
+// ImportCSVReader import csv into table, values are validated and coerced by column types.
+// An empty value of not null column with default is omitted, the row is inserted alone.
+func (d *Database) ImportCSVReader(table string, r io.Reader, opts ImportOptions) (ImportResult, error) {
+	var result ImportResult
+	cols, err := d.TableColumns(table)
+	if err != nil {
+		return result, err
+	}
+
+	src, _, err := csvDecodeReader(r, opts.CSV.Charset)
+	if err != nil {
+		return result, err
+	}
+	sep, quote := opts.CSV.Sep, opts.CSV.Quote
+	if sep == 0 {
+		sep = ','
+	}
+	if quote == 0 {
+		quote = '"'
+	}
+	if opts.CSV.NoQuote {
+		quote = 0
+	}
+	cr := csvReader{r: bufio.NewReader(src), sep: sep, quote: quote, trim: opts.CSV.TrimSpace}
+
+	header, _, err := cr.Read()
+	if err == io.EOF {
+		return result, errors.New("csv is empty")
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Header = header
+
+	im, err := newImporter(d, table, cols, header, opts)
+	if err != nil {
+		return result, err
+	}
+	result.Columns = im.ds.Fields
+	result.Ignored = im.ignored
+	result, err = im.run(&cr, &result)
+	// rows of failed batches are rejected later
+	sort.SliceStable(result.Rejected, func(i, j int) bool {
+		return result.Rejected[i].Line < result.Rejected[j].Line
+	})
+	return result, err
+}
+
+// importer state
+type importer struct {
+	database    *Database
+	table       string
+	opts        ImportOptions
+	timeFormats []string
+
+	// fields of header
+	nfields int
+	// index of header for each column
+	index   []int
+	cols    []TableColumn
+	ignored []string
+
+	tx      *Tx
+	ds      DataSet
+	lines   []int
+	records [][]string
+}
+
+func newImporter(d *Database, table string, cols []TableColumn, header []string, opts ImportOptions) (*importer, error) {
+	if opts.BatchSize < 1 {
+		opts.BatchSize = defaultImportBatch
+	}
+	im := &importer{database: d, table: table, opts: opts, timeFormats: opts.CSV.TimeFormats, nfields: len(header)}
+	if len(im.timeFormats) == 0 {
+		im.timeFormats = CSVTimeFormats
+	}
+
+	colMap := make(map[string]int, len(cols))
+	for i, c := range cols {
+		colMap[importName(c.Name)] = i
+	}
+
+	var fields []string
+	used := make(map[int]bool)
+	for i, h := range header {
+		name, ok := opts.Mapping[h]
+		if !ok {
+			name = h
+		}
+		k, found := colMap[importName(name)]
+		if name == "-" || !found || used[k] {
+			im.ignored = append(im.ignored, h)
+			continue
+		}
+		used[k] = true
+		im.index = append(im.index, i)
+		im.cols = append(im.cols, cols[k])
+		fields = append(fields, cols[k].Name)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("no csv header matches columns of " + table)
+	}
+
+	// required columns
+	for k, c := range cols {
+		if !used[k] && !c.Nullable && !c.HasDefault {
+			return nil, errors.New("column " + c.Name + " is required, but not found in csv header")
+		}
+	}
+
+	im.ds = NewDataSet(fields)
+	return im, nil
+}
+
+// importName lower case, spaces and - as _
+func importName(s string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(s)))
+}
+
+func (im *importer) run(cr *csvReader, result *ImportResult) (ImportResult, error) {
+	var err error
+	if im.opts.InTx {
+		tx := Tx{database: im.database}
+		tx.tx, err = im.database.DB().Begin()
+		if err != nil {
+			return *result, err
+		}
+		im.tx = &tx
+	}
+
+	row := make([]interface{}, len(im.cols))
+	for {
+		record, line, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			im.rollback(result)
+			return *result, fmt.Errorf("csv line %d: %s", line, err.Error())
+		}
+		result.Rows++
+
+		if reason := im.convert(record, row); reason != "" {
+			im.reject(result, line, record, reason)
+		} else if im.hasDefault(row) {
+			if err = im.insertRow(result, line, record, row); err != nil {
+				im.rollback(result)
+				return *result, err
+			}
+		} else {
+			im.ds.AddRow(row)
+			im.lines = append(im.lines, line)
+			im.records = append(im.records, record)
+		}
+
+		if im.opts.MaxErrors > 0 && len(result.Rejected) > im.opts.MaxErrors {
+			im.rollback(result)
+			return *result, fmt.Errorf("import stopped, rejected rows > %d", im.opts.MaxErrors)
+		}
+		if im.ds.Len() >= im.opts.BatchSize {
+			if err = im.flush(result); err != nil {
+				im.rollback(result)
+				return *result, err
+			}
+		}
+	}
+
+	if err = im.flush(result); err != nil {
+		im.rollback(result)
+		return *result, err
+	}
+	if im.tx != nil {
+		if err = im.tx.Commit(); err != nil {
+			result.Inserted = 0
+			return *result, err
+		}
+	}
+	return *result, nil
+}
+
+func (im *importer) rollback(result *ImportResult) {
+	if im.tx == nil {
+		return
+	}
+	im.tx.Rollback()
+	result.Inserted = 0
+}
+
+func (im *importer) reject(result *ImportResult, line int, record []string, reason string) {
+	result.Rejected = append(result.Rejected, ImportRejected{Line: line, Record: record, Reason: reason})
+}
+
+func (im *importer) newInsert() InsertBuilder {
+	if im.tx != nil {
+		return im.tx.NewInsert(im.table)
+	}
+	return im.database.NewInsert(im.table)
+}
+
+// flush insert batch
+func (im *importer) flush(result *ImportResult) error {
+	l := im.ds.Len()
+	if l == 0 {
+		return nil
+	}
+	defer im.reset()
+
+	ins := im.newInsert()
+	_, err := ins.InsertM(&im.ds)
+	if err == nil {
+		result.Inserted += l
+		return nil
+	}
+	if im.tx != nil {
+		return fmt.Errorf("insert rows of line %d-%d: %s", im.lines[0], im.lines[l-1], err.Error())
+	}
+
+	// retry one by one to find rejected rows
+	row := make([]interface{}, len(im.ds.Fields))
+	for i := 0; i < l; i++ {
+		im.ds.RowAt(i, row)
+		if _, err = ins.Insert(im.ds.Fields, row); err != nil {
+			im.reject(result, im.lines[i], im.records[i], err.Error())
+			continue
+		}
+		result.Inserted++
+	}
+	return nil
+}
+
+// hasDefault row has empty values of not null columns with default
+func (im *importer) hasDefault(row []interface{}) bool {
+	for _, v := range row {
+		if _, ok := v.(importDefault); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// insertRow insert one row without the default columns, so defaults of table apply
+func (im *importer) insertRow(result *ImportResult, line int, record []string, row []interface{}) error {
+	fields := make([]string, 0, len(row))
+	values := make([]interface{}, 0, len(row))
+	for k, v := range row {
+		if _, ok := v.(importDefault); ok {
+			continue
+		}
+		fields = append(fields, im.ds.Fields[k])
+		values = append(values, v)
+	}
+
+	ins := im.newInsert()
+	if _, err := ins.Insert(fields, values); err != nil {
+		if im.tx != nil {
+			return fmt.Errorf("insert row of line %d: %s", line, err.Error())
+		}
+		im.reject(result, line, record, err.Error())
+		return nil
+	}
+	result.Inserted++
+	return nil
+}
+
+func (im *importer) reset() {
+	for k := range im.ds.Columns {
+		im.ds.Columns[k] = im.ds.Columns[k][:0]
+	}
+	im.lines = im.lines[:0]
+	im.records = im.records[:0]
+}
+
+// convert record to row, return the reason if it is rejected
+func (im *importer) convert(record []string, row []interface{}) string {
+	if len(record) != im.nfields {
+		return fmt.Sprintf("expected %d fields, got %d", im.nfields, len(record))
+	}
+	for k, i := range im.index {
+		c := &im.cols[k]
+		v, err := importValue(record[i], c, im.timeFormats)
+		if err != nil {
+			return c.Name + ": " + err.Error()
+		}
+		row[k] = v
+	}
+	return ""
+}
+
+// importDefault empty value of not null column with default, the column is omitted
+type importDefault struct{}
+
+// importValue coerce csv value by column data type
+func importValue(s string, c *TableColumn, timeFormats []string) (interface{}, error) {
+	if s == "" {
+		switch {
+		case c.Nullable:
+			return nil, nil
+		case c.HasDefault:
+			return importDefault{}, nil
+		}
+		return nil, errors.New("value is required")
+	}
+
+	switch c.DataType {
+	case "smallint", "integer", "bigint", "int", "tinyint", "mediumint":
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+
+	case "real", "double precision", "double", "float":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+
+	case "numeric", "decimal":
+		// keep the text for precision
+		s = strings.TrimSpace(s)
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, err
+		}
+		return s, nil
+
+	case "boolean":
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "y", "yes", "on":
+			return true, nil
+		case "n", "no", "off":
+			return false, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(s))
+
+	case "date", "timestamp without time zone", "timestamp with time zone", "datetime", "timestamp":
+		return csvParseValue(strings.TrimSpace(s), CSVTime, timeFormats)
+
+	case "json", "jsonb":
+		if !json.Valid([]byte(s)) {
+			return nil, errors.New("invalid json")
+		}
+		return s, nil
+
+	case "character varying", "character", "varchar", "char":
+		if c.MaxLength > 0 && utf8.RuneCountInString(s) > c.MaxLength {
+			return nil, fmt.Errorf("value is longer than %d", c.MaxLength)
+		}
+	}
+	return s, nil
+}
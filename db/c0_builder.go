@@ -2,17 +2,23 @@ package db
 
 import (
 	"database/sql"
+	"time"
 )
 
 type Builder struct {
 	table string
 
 	tx       *sql.Tx
+	dbtx     *Tx
 	database *Database
 
 	isTx      bool
 	LastError error
 	isPrepare bool
+	skipHooks bool
+
+	// searchPath of tenant
+	searchPath string
 }
 
 // NewBuilder return
@@ -45,6 +51,25 @@ func (b *Builder) GetTx() *sql.Tx {
 
 // cQuery db tx
 func (b *Builder) cQuery(isPool bool, sqlstr string, args []interface{}) (DataSet, error) {
+	if b.searchPath != "" && !b.isTx {
+		var ds DataSet
+		err := b.inTenantTx(func(tb *Builder) (err error) {
+			ds, err = tb.cQuery(isPool, sqlstr, args)
+			return err
+		})
+		return ds, err
+	}
+
+	if stats := b.GetDatabase().getStats(); stats != nil {
+		now := time.Now()
+		ds, err := b.query(isPool, sqlstr, args)
+		stats.record(sqlstr, time.Since(now), int64(ds.Len()), err)
+		return ds, err
+	}
+	return b.query(isPool, sqlstr, args)
+}
+
+func (b *Builder) query(isPool bool, sqlstr string, args []interface{}) (DataSet, error) {
 	var err error
 	var rows *sql.Rows
 	// b.GetDatabase().Log(sqlstr, args)
@@ -80,6 +105,24 @@ func (b *Builder) cQuery(isPool bool, sqlstr string, args []interface{}) (DataSe
 func (b *Builder) Exec(sqlstr string, args []interface{}) (sql.Result, error) {
 	// sqlstr := string(b.database.AdaptSql(item.Sql))
 	// b.GetDatabase().Log(sqlstr, args)
+	if b.searchPath != "" && !b.isTx {
+		var r sql.Result
+		err := b.inTenantTx(func(tb *Builder) (err error) {
+			r, err = tb.Exec(sqlstr, args)
+			return err
+		})
+		return r, err
+	}
+	if stats := b.GetDatabase().getStats(); stats != nil {
+		now := time.Now()
+		r, err := b.exec(sqlstr, args)
+		stats.record(sqlstr, time.Since(now), rowsAffected(r), err)
+		return r, err
+	}
+	return b.exec(sqlstr, args)
+}
+
+func (b *Builder) exec(sqlstr string, args []interface{}) (sql.Result, error) {
 	if b.isTx {
 		return b.tx.Exec(sqlstr, args...)
 	}
@@ -87,6 +130,14 @@ func (b *Builder) Exec(sqlstr string, args []interface{}) (sql.Result, error) {
 	return b.GetDatabase().DB().Exec(sqlstr, args...)
 }
 
+func rowsAffected(r sql.Result) int64 {
+	if r == nil {
+		return 0
+	}
+	n, _ := r.RowsAffected()
+	return n
+}
+
 // LastInsertID return lastid
 func (b *Builder) LastInsertID(table, pkey string) int64 {
 	var r *sql.Row
@@ -107,6 +158,24 @@ func (b *Builder) LastInsertID(table, pkey string) int64 {
 // ExecPrepare db
 func (b *Builder) ExecPrepare(sqlstr string, args []interface{}) (sql.Result, error) {
 	// b.GetDatabase().Log(sqlstr, args)
+	if b.searchPath != "" && !b.isTx {
+		var r sql.Result
+		err := b.inTenantTx(func(tb *Builder) (err error) {
+			r, err = tb.ExecPrepare(sqlstr, args)
+			return err
+		})
+		return r, err
+	}
+	if stats := b.GetDatabase().getStats(); stats != nil {
+		now := time.Now()
+		r, err := b.execPrepare(sqlstr, args)
+		stats.record(sqlstr, time.Since(now), rowsAffected(r), err)
+		return r, err
+	}
+	return b.execPrepare(sqlstr, args)
+}
+
+func (b *Builder) execPrepare(sqlstr string, args []interface{}) (sql.Result, error) {
 	var st *sql.Stmt
 	var err error
 	if b.isTx {
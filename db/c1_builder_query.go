@@ -20,6 +20,25 @@ type QueryBuilder struct {
 	order    string
 	limit    int
 	offset   int
+
+	withs     []queryPart
+	unions    []queryPart
+	fromQuery *QueryBuilder
+
+	// keyset pagination
+	isBefore   bool
+	cursorVals []interface{}
+	cursorErr  error
+
+	search    *searchPart
+	searchErr error
+}
+
+// queryPart CTE or union
+type queryPart struct {
+	name  string
+	isAll bool
+	q     *QueryBuilder
 }
 
 // NewQuery new
@@ -90,15 +109,103 @@ func (q *QueryBuilder) Offset(n int) *QueryBuilder {
 	return q
 }
 
+// With add CTE: WITH name AS (sub)
+func (q *QueryBuilder) With(name string, sub *QueryBuilder) *QueryBuilder {
+	q.withs = append(q.withs, queryPart{name: name, q: sub})
+	return q
+}
+
+// FromQuery use sub query as table source: FROM (sub) AS alias
+func (q *QueryBuilder) FromQuery(sub *QueryBuilder, alias string) *QueryBuilder {
+	q.fromQuery = sub
+	q.table = alias
+	return q
+}
+
+// Union combine query: q UNION (other)
+func (q *QueryBuilder) Union(other *QueryBuilder) *QueryBuilder {
+	q.unions = append(q.unions, queryPart{q: other})
+	return q
+}
+
+// UnionAll combine query: q UNION ALL (other)
+func (q *QueryBuilder) UnionAll(other *QueryBuilder) *QueryBuilder {
+	q.unions = append(q.unions, queryPart{q: other, isAll: true})
+	return q
+}
+
 // Parse sql
 func (q *QueryBuilder) Parse() string {
+	str, _ := q.ParseArgs()
+	return str
+}
+
+// ParseArgs sql and args.
+// Placeholders of sub queries, CTEs and unions are renumbered in the combined statement.
+// A *QueryBuilder in Where args is written as a sub query: Where("code IN $1", &sub)
+func (q *QueryBuilder) ParseArgs() (string, []interface{}) {
+	if q.isSimple() {
+		return q.parseSimple(), q.args
+	}
+	buf := bytebufferpool.Get()
+	args := q.build(buf, nil)
+	str := buf.String()
+	bytebufferpool.Put(buf)
+	return str, args
+}
+
+// isSimple without sub queries
+func (q *QueryBuilder) isSimple() bool {
+	return len(q.withs) == 0 && len(q.unions) == 0 && q.fromQuery == nil && !q.isKeyset() && q.search == nil && !hasSubQuery(q.args)
+}
+
+func hasSubQuery(args []interface{}) bool {
+	for _, arg := range args {
+		switch arg.(type) {
+		case *QueryBuilder, QueryBuilder:
+			return true
+		}
+	}
+	return false
+}
+
+func (q *QueryBuilder) parseSimple() string {
 	buf := bytebufferpool.Get()
+	q.build(buf, nil)
+	str := buf.String()
+	// bytePool.Put(buf)
+	bytebufferpool.Put(buf)
+	return str
+}
+
+// build write sql, append args to out
+func (q *QueryBuilder) build(buf *bytebufferpool.ByteBuffer, out []interface{}) []interface{} {
+	if len(q.withs) > 0 {
+		buf.Write(bSQLWith)
+		for i, w := range q.withs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(w.name)
+			buf.Write(bSQLAs)
+			buf.WriteByte('(')
+			out = w.q.build(buf, out)
+			buf.WriteByte(')')
+		}
+		buf.WriteByte(' ')
+	}
 
 	buf.Write(bSQLSelect)
 
 	setQueryFields(q, buf)
 
 	buf.Write(bSQLFrom)
+	if q.fromQuery != nil {
+		buf.WriteByte('(')
+		out = q.fromQuery.build(buf, out)
+		buf.WriteByte(')')
+		buf.Write(bSQLAs)
+	}
 	buf.WriteString(q.table)
 
 	if q.leftJoin != "" {
@@ -106,14 +213,49 @@ func (q *QueryBuilder) Parse() string {
 		buf.WriteString(q.leftJoin)
 	}
 
-	if q.where != "" {
+	where, args, order := q.where, q.args, q.order
+	if q.isKeyset() {
+		where, args, order = q.keyset()
+	}
+
+	if where != "" || q.search != nil {
 		buf.Write(bSQLWhere)
-		buf.WriteString(q.where)
+	}
+	if where != "" && q.search != nil {
+		buf.WriteByte('(')
+		out = writeClause(buf, where, args, out)
+		buf.WriteByte(')')
+		buf.Write(bSQLAnd)
+	} else if where != "" {
+		out = writeClause(buf, where, args, out)
+	}
+	if q.search != nil {
+		var tsquery string
+		out, tsquery = q.search.write(buf, out)
+		if q.search.rank {
+			rank := "ts_rank(" + q.search.vector + ", " + tsquery + ") DESC"
+			if order == "" {
+				order = rank
+			} else {
+				order = rank + util.SComma + order
+			}
+		}
+	}
+
+	for _, u := range q.unions {
+		if u.isAll {
+			buf.Write(bSQLUnionAll)
+		} else {
+			buf.Write(bSQLUnion)
+		}
+		buf.WriteByte('(')
+		out = u.q.build(buf, out)
+		buf.WriteByte(')')
 	}
 
-	if q.order != "" {
+	if order != "" {
 		buf.Write(bSQLOrder)
-		buf.WriteString(q.order)
+		buf.WriteString(order)
 	}
 
 	limit := q.limit
@@ -130,23 +272,113 @@ func (q *QueryBuilder) Parse() string {
 		buf.Write(bSQLOffset)
 		buf.WriteString(strconv.FormatInt(int64(q.offset), 10))
 	}
-	str := buf.String()
-	// bytePool.Put(buf)
-	bytebufferpool.Put(buf)
+	return out
+}
 
-	return str
+// writeClause write clause with $n placeholders renumbered after out.
+// Normal args keep their order, *QueryBuilder args are written as (sub query).
+func writeClause(buf *bytebufferpool.ByteBuffer, clause string, args []interface{}, out []interface{}) []interface{} {
+	n := len(args)
+	if len(out) == 0 && !hasSubQuery(args) {
+		buf.WriteString(clause)
+		return append(out, args...)
+	}
+	index := make([]int, n)
+	subs := make([]*QueryBuilder, n)
+	for i := 0; i < n; i++ {
+		switch v := args[i].(type) {
+		case *QueryBuilder:
+			subs[i] = v
+		case QueryBuilder:
+			subs[i] = &v
+		default:
+			out = append(out, v)
+			index[i] = len(out)
+		}
+	}
+
+	subSQL := make([]string, n)
+	for i := 0; i < n; i++ {
+		if subs[i] == nil {
+			continue
+		}
+		sb := bytebufferpool.Get()
+		out = subs[i].build(sb, out)
+		subSQL[i] = sb.String()
+		bytebufferpool.Put(sb)
+	}
+
+	l := len(clause)
+	inQuote := false
+	for i := 0; i < l; i++ {
+		c := clause[i]
+		if c == '\'' {
+			inQuote = !inQuote
+		}
+		if inQuote || c != '$' || i+1 >= l || clause[i+1] < '0' || clause[i+1] > '9' {
+			buf.WriteByte(c)
+			continue
+		}
+		k := i + 1
+		for k < l && clause[k] >= '0' && clause[k] <= '9' {
+			k++
+		}
+		seq, _ := strconv.Atoi(clause[i+1 : k])
+		switch {
+		case seq < 1 || seq > n:
+			buf.WriteString(clause[i:k])
+		case subs[seq-1] != nil:
+			buf.WriteByte('(')
+			buf.WriteString(subSQL[seq-1])
+			buf.WriteByte(')')
+		default:
+			buf.Write(util.BDoller)
+			buf.WriteString(strconv.Itoa(index[seq-1]))
+		}
+		i = k - 1
+	}
+	return out
+}
+
+// buildErr error of search, cursor or sub queries, it is returned by Query
+func (q *QueryBuilder) buildErr() error {
+	if q.searchErr != nil {
+		return q.searchErr
+	}
+	if err := q.keysetErr(); err != nil {
+		return err
+	}
+	if q.fromQuery != nil {
+		if err := q.fromQuery.buildErr(); err != nil {
+			return err
+		}
+	}
+	for _, parts := range [][]queryPart{q.withs, q.unions} {
+		for _, p := range parts {
+			if err := p.q.buildErr(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // QueryP return DataSet
 func (q *QueryBuilder) QueryP() (DataSet, error) {
-	sqlstr := q.Parse()
-	return q.cQuery(true, sqlstr, q.args)
+	if err := q.buildErr(); err != nil {
+		return DataSet{}, err
+	}
+	sqlstr, args := q.ParseArgs()
+	return q.cQuery(true, sqlstr, args)
 }
 
 // Query return DataSet
 func (q *QueryBuilder) Query() (DataSet, error) {
-	sqlstr := q.Parse()
-	return q.cQuery(false, sqlstr, q.args)
+	if err := q.buildErr(); err != nil {
+		return DataSet{}, err
+	}
+	sqlstr, args := q.ParseArgs()
+	return q.cQuery(false, sqlstr, args)
 }
 
 // QueryOne limit=1
@@ -161,11 +393,14 @@ func (q *QueryBuilder) QueryOneP() (DBRow, error) {
 
 // QueryOne limit=1
 func (q *QueryBuilder) queryOne(isPool bool) (DBRow, error) {
+	if err := q.buildErr(); err != nil {
+		return DBRow{}, err
+	}
 	limit := q.limit
 	q.limit = 1
-	sqlstr := q.Parse()
+	sqlstr, args := q.ParseArgs()
 
-	ds, err := q.cQuery(true, sqlstr, q.args)
+	ds, err := q.cQuery(true, sqlstr, args)
 	defer PutDataSet(&ds)
 	q.limit = limit
 	if err != nil {
@@ -45,6 +45,12 @@ func (ins *InsertBuilder) AddSkipFields(fields ...string) *InsertBuilder {
 	return ins
 }
 
+// SkipHooks do not run insert hooks
+func (ins *InsertBuilder) SkipHooks() *InsertBuilder {
+	ins.skipHooks = true
+	return ins
+}
+
 // Table string
 func (ins *InsertBuilder) Table(t string) *InsertBuilder {
 	ins.table = t
@@ -57,27 +63,41 @@ func (ins *InsertBuilder) Insert(fields []string, row []interface{}) (sql.Result
 	if n != len(row) {
 		return nil, fmt.Errorf("insert %s fields.Len() != row.Len() fields: %s row.Len()=%d", ins.table, fields, len(row))
 	}
-	sqlstr := parseInsert(ins, fields, ins.isReturnID)
-	vals := GetRow(n)
-	defer PutRow(vals)
-	driver := ins.GetDatabase().Driver
-	for i := 0; i < n; i++ {
-		vals[i] = driver.StoreData(fields[i], row[i])
-	}
-	if ins.isPrepare {
-		return ins.Exec(sqlstr, vals)
+	hc := ins.newHookContext(ActionInsert)
+	if hc != nil {
+		hc.Fields = fields
+		hc.Values = row
 	}
-	return ins.ExecPrepare(sqlstr, vals)
+	return ins.execWithHooks(hc, func(b *Builder) (sql.Result, error) {
+		sqlstr := parseInsert(ins, fields, ins.isReturnID)
+		vals := GetRow(n)
+		defer PutRow(vals)
+		driver := ins.GetDatabase().Driver
+		for i := 0; i < n; i++ {
+			vals[i] = driver.StoreData(fields[i], row[i])
+		}
+		if ins.isPrepare {
+			return b.Exec(sqlstr, vals)
+		}
+		return b.ExecPrepare(sqlstr, vals)
+	})
 }
 
 // InsertM func
 func (ins *InsertBuilder) InsertM(dat *DataSet) (sql.Result, error) {
-	sqlstr, vals := parseInsertMP(ins, dat)
-	defer PutColumn(vals)
-	if ins.isPrepare {
-		return ins.Exec(sqlstr, vals)
+	hc := ins.newHookContext(ActionInsert)
+	if hc != nil {
+		hc.Fields = dat.Fields
+		hc.DataSet = dat
 	}
-	return ins.ExecPrepare(sqlstr, vals)
+	return ins.execWithHooks(hc, func(b *Builder) (sql.Result, error) {
+		sqlstr, vals := parseInsertMP(ins, dat)
+		defer PutColumn(vals)
+		if ins.isPrepare {
+			return b.Exec(sqlstr, vals)
+		}
+		return b.ExecPrepare(sqlstr, vals)
+	})
 }
 
 // InsertMN
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
 	"github.com/kere/gno/libs/util"
 	"github.com/valyala/bytebufferpool"
@@ -35,6 +37,12 @@ func (u *UpdateBuilder) Prepare(v bool) *UpdateBuilder {
 	return u
 }
 
+// SkipHooks do not run update hooks
+func (u *UpdateBuilder) SkipHooks() *UpdateBuilder {
+	u.skipHooks = true
+	return u
+}
+
 // Where sql
 func (u *UpdateBuilder) Where(cond string, args ...interface{}) *UpdateBuilder {
 	if cond == "" {
@@ -47,11 +55,20 @@ func (u *UpdateBuilder) Where(cond string, args ...interface{}) *UpdateBuilder {
 
 // Update db
 func (u *UpdateBuilder) Update(fields []string, row []interface{}) (sql.Result, error) {
-	sqlstr, vals := u.ParseP(fields, row)
-	if u.isPrepare {
-		return u.ExecPrepare(sqlstr, vals)
+	hc := u.newHookContext(ActionUpdate)
+	if hc != nil {
+		hc.Fields = fields
+		hc.Values = row
+		hc.Where = u.where
+		hc.Args = u.args
 	}
-	return u.Exec(sqlstr, vals)
+	return u.execWithHooks(hc, func(b *Builder) (sql.Result, error) {
+		sqlstr, vals := u.ParseP(fields, row)
+		if u.isPrepare {
+			return b.ExecPrepare(sqlstr, vals)
+		}
+		return b.Exec(sqlstr, vals)
+	})
 }
 
 // ParseP sql
@@ -104,3 +121,279 @@ func writeUpdate(w io.Writer, driver IDriver, fields []string, values []interfac
 
 	return seq
 }
+
+// UpdateM update many rows in one statement, rows are matched by keyField.
+// postgres: UPDATE t AS a SET f=b.f FROM (VALUES (...),(...)) AS b(key,f) WHERE a.key=b.key
+// mysql: UPDATE t SET f=CASE key WHEN ? THEN ? ... ELSE f END WHERE key IN (...)
+// On postgres values are cast to ds.Types, missing types are read from the table once
+// and cached, call ClearColumnTypes after the table is altered.
+// Where is appended with AND, on postgres the table is aliased as a, the values as b.
+func (u *UpdateBuilder) UpdateM(ds *DataSet, keyField string) (sql.Result, error) {
+	if ds.Len() == 0 {
+		return &insResult{}, nil
+	}
+	typs, err := u.valueTypes(ds)
+	if err != nil {
+		return nil, err
+	}
+	return u.updateM(ds, keyField, typs)
+}
+
+func (u *UpdateBuilder) updateM(ds *DataSet, keyField string, typs []string) (sql.Result, error) {
+	hc := u.newHookContext(ActionUpdate)
+	if hc != nil {
+		hc.Fields = ds.Fields
+		hc.DataSet = ds
+		hc.KeyField = keyField
+		hc.Where = u.where
+		hc.Args = u.args
+	}
+	return u.execWithHooks(hc, func(b *Builder) (sql.Result, error) {
+		sqlstr, vals, err := u.parseUpdateM(ds, keyField, typs)
+		if err != nil {
+			return nil, err
+		}
+		defer PutColumn(vals)
+		if u.isPrepare {
+			return b.ExecPrepare(sqlstr, vals)
+		}
+		return b.Exec(sqlstr, vals)
+	})
+}
+
+// UpdateMN update many rows, n rows per statement
+func (u *UpdateBuilder) UpdateMN(ds *DataSet, keyField string, n int) error {
+	if ds.Len() == 0 {
+		return nil
+	}
+	typs, err := u.valueTypes(ds)
+	if err != nil {
+		return err
+	}
+	ds.EachPage(n, func(page int, dat DataSet) bool {
+		_, err = u.updateM(&dat, keyField, typs)
+		return err == nil
+	})
+	return err
+}
+
+// valueTypes postgres type names of dataset fields, for casting VALUES
+func (u *UpdateBuilder) valueTypes(ds *DataSet) ([]string, error) {
+	if u.GetDatabase().Driver.Name() == DriverMySQL {
+		return nil, nil
+	}
+	n := len(ds.Fields)
+	typs := make([]string, n)
+	if len(ds.Types) == n {
+		for i := 0; i < n; i++ {
+			typs[i] = ds.Types[i].TypeName
+		}
+	}
+	if util.InStrings("", typs) {
+		cols, err := u.columnTypes()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			if typs[i] != "" {
+				continue
+			}
+			typ, ok := cols[ds.Fields[i]]
+			if !ok {
+				return nil, fmt.Errorf("update %s field %s not found", u.table, ds.Fields[i])
+			}
+			typs[i] = typ
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		// _INT4 -> INT4[]
+		if strings.HasPrefix(typs[i], "_") {
+			typs[i] = typs[i][1:] + "[]"
+		}
+	}
+	return typs, nil
+}
+
+// ClearColumnTypes clear column types cached by UpdateM
+func (d *Database) ClearColumnTypes() {
+	d.colTypes.Range(func(k, v interface{}) bool {
+		d.colTypes.Delete(k)
+		return true
+	})
+}
+
+// columnTypes type names of table columns, they are read once and cached by database.
+// The cache key is search_path and table, tenants may have different columns.
+func (u *UpdateBuilder) columnTypes() (map[string]string, error) {
+	d := u.GetDatabase()
+	key := u.searchPath + " " + u.table
+	if v, ok := d.colTypes.Load(key); ok {
+		return v.(map[string]string), nil
+	}
+
+	buf := bytebufferpool.Get()
+	buf.Write(bSQLSelect)
+	buf.Write(util.BStarKey)
+	buf.Write(bSQLFrom)
+	d.Driver.WriteQuoteIdentifier(buf, u.table)
+	buf.Write(bSQLLimit)
+	buf.WriteByte('0')
+	dat, err := u.cQuery(false, buf.String(), nil)
+	bytebufferpool.Put(buf)
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]string, len(dat.Fields))
+	for i, field := range dat.Fields {
+		if i < len(dat.Types) {
+			cols[field] = dat.Types[i].TypeName
+		}
+	}
+	d.colTypes.Store(key, cols)
+	return cols, nil
+}
+
+func (u *UpdateBuilder) parseUpdateM(ds *DataSet, keyField string, typs []string) (string, []interface{}, error) {
+	keyI := util.StringsI(keyField, ds.Fields)
+	if keyI < 0 {
+		return "", nil, fmt.Errorf("update %s key field %s not found", u.table, keyField)
+	}
+	if len(ds.Fields) < 2 {
+		return "", nil, fmt.Errorf("update %s no fields to update", u.table)
+	}
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+	values := GetColumn(0)
+
+	driver := u.GetDatabase().Driver
+	isMySQL := driver.Name() == DriverMySQL
+	if isMySQL {
+		values = writeUpdateMCase(buf, driver, u.table, ds, keyI, values)
+	} else {
+		// where args are $1...
+		if u.where != "" {
+			values = append(values, u.args...)
+		}
+		values = writeUpdateMValues(buf, driver, u.table, ds, keyI, typs, values)
+	}
+	if u.where != "" {
+		buf.Write(bSQLAnd)
+		buf.WriteByte('(')
+		buf.WriteString(u.where)
+		buf.WriteByte(')')
+		if isMySQL {
+			values = append(values, u.args...)
+		}
+	}
+	return buf.String(), values, nil
+}
+
+// writeUpdateMValues postgres
+func writeUpdateMValues(buf *bytebufferpool.ByteBuffer, driver IDriver, table string, ds *DataSet, keyI int, typs []string, values []interface{}) []interface{} {
+	n := len(ds.Fields)
+	l := ds.Len()
+	seq := len(values) + 1
+
+	buf.Write(bSQLUpdate)
+	driver.WriteQuoteIdentifier(buf, table)
+	buf.Write(bSQLAsA)
+	buf.Write(bSQLSet)
+	isFirst := true
+	for k := 0; k < n; k++ {
+		if k == keyI {
+			continue
+		}
+		if !isFirst {
+			buf.WriteByte(',')
+		}
+		isFirst = false
+		driver.WriteQuoteIdentifier(buf, ds.Fields[k])
+		buf.WriteString("=b.")
+		driver.WriteQuoteIdentifier(buf, ds.Fields[k])
+	}
+
+	buf.Write(bSQLFrom)
+	buf.WriteString("(VALUES ")
+	for i := 0; i < l; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('(')
+		for k := 0; k < n; k++ {
+			if k > 0 {
+				buf.WriteByte(',')
+			}
+			values = append(values, driver.StoreData(ds.Fields[k], ds.Columns[k][i]))
+			buf.Write(util.BDoller)
+			buf.B = strconv.AppendInt(buf.B, int64(seq), 10)
+			seq++
+			if typs[k] != "" {
+				buf.WriteString("::")
+				buf.WriteString(typs[k])
+			}
+		}
+		buf.WriteByte(')')
+	}
+	buf.WriteString(") AS b(")
+	for k := 0; k < n; k++ {
+		if k > 0 {
+			buf.WriteByte(',')
+		}
+		driver.WriteQuoteIdentifier(buf, ds.Fields[k])
+	}
+	buf.WriteByte(')')
+
+	buf.Write(bSQLWhere)
+	buf.WriteString("a.")
+	driver.WriteQuoteIdentifier(buf, ds.Fields[keyI])
+	buf.WriteString("=b.")
+	driver.WriteQuoteIdentifier(buf, ds.Fields[keyI])
+	return values
+}
+
+// writeUpdateMCase mysql
+func writeUpdateMCase(buf *bytebufferpool.ByteBuffer, driver IDriver, table string, ds *DataSet, keyI int, values []interface{}) []interface{} {
+	n := len(ds.Fields)
+	l := ds.Len()
+	key := ds.Fields[keyI]
+	keys := ds.Columns[keyI]
+
+	buf.Write(bSQLUpdate)
+	driver.WriteQuoteIdentifier(buf, table)
+	buf.Write(bSQLSet)
+	isFirst := true
+	for k := 0; k < n; k++ {
+		if k == keyI {
+			continue
+		}
+		if !isFirst {
+			buf.WriteByte(',')
+		}
+		isFirst = false
+		driver.WriteQuoteIdentifier(buf, ds.Fields[k])
+		buf.WriteString("=CASE ")
+		driver.WriteQuoteIdentifier(buf, key)
+		for i := 0; i < l; i++ {
+			buf.WriteString(" WHEN ? THEN ?")
+			values = append(values, driver.StoreData(key, keys[i]), driver.StoreData(ds.Fields[k], ds.Columns[k][i]))
+		}
+		buf.WriteString(" ELSE ")
+		driver.WriteQuoteIdentifier(buf, ds.Fields[k])
+		buf.WriteString(" END")
+	}
+
+	buf.Write(bSQLWhere)
+	driver.WriteQuoteIdentifier(buf, key)
+	buf.WriteString(" IN (")
+	for i := 0; i < l; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('?')
+		values = append(values, driver.StoreData(key, keys[i]))
+	}
+	buf.WriteByte(')')
+	return values
+}
@@ -32,6 +32,12 @@ func (d *DeleteBuilder) Prepare(v bool) *DeleteBuilder {
 	return d
 }
 
+// SkipHooks do not run delete hooks
+func (d *DeleteBuilder) SkipHooks() *DeleteBuilder {
+	d.skipHooks = true
+	return d
+}
+
 // Where sql
 func (d *DeleteBuilder) Where(s string, args ...interface{}) *DeleteBuilder {
 	d.where = s
@@ -41,10 +47,17 @@ func (d *DeleteBuilder) Where(s string, args ...interface{}) *DeleteBuilder {
 
 // Delete delete
 func (d *DeleteBuilder) Delete() (sql.Result, error) {
-	if d.isPrepare {
-		return d.ExecPrepare(parseDelete(d), d.args)
+	hc := d.newHookContext(ActionDelete)
+	if hc != nil {
+		hc.Where = d.where
+		hc.Args = d.args
 	}
-	return d.Exec(parseDelete(d), d.args)
+	return d.execWithHooks(hc, func(b *Builder) (sql.Result, error) {
+		if d.isPrepare {
+			return b.ExecPrepare(parseDelete(d), d.args)
+		}
+		return b.Exec(parseDelete(d), d.args)
+	})
 }
 
 func parseDelete(d *DeleteBuilder) string {
@@ -64,6 +64,7 @@ func (t *Tx) NewBuilder(table string) Builder {
 	b.database = t.database
 	b.isTx = true
 	b.tx = t.tx
+	b.dbtx = t
 	return b
 }
 
@@ -73,6 +74,7 @@ func (t *Tx) NewQuery(table string) QueryBuilder {
 	q.database = t.database
 	q.isTx = true
 	q.tx = t.tx
+	q.dbtx = t
 	return q
 }
 
@@ -82,6 +84,7 @@ func (t *Tx) NewInsert(table string) InsertBuilder {
 	ins.database = t.database
 	ins.isTx = true
 	ins.tx = t.tx
+	ins.dbtx = t
 	return ins
 }
 
@@ -91,6 +94,7 @@ func (t *Tx) NewUpdate(table string) UpdateBuilder {
 	u.database = t.database
 	u.isTx = true
 	u.tx = t.tx
+	u.dbtx = t
 	return u
 }
 
@@ -100,6 +104,7 @@ func (t *Tx) NewDelete(table string) DeleteBuilder {
 	del.database = t.database
 	del.isTx = true
 	del.tx = t.tx
+	del.dbtx = t
 	return del
 }
 
@@ -109,5 +114,6 @@ func (t *Tx) NewExists(table string) ExistsBuilder {
 	e.database = t.database
 	e.isTx = true
 	e.tx = t.tx
+	e.dbtx = t
 	return e
 }
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+)
+
+const (
+	// ActionInsert insert
+	ActionInsert = "insert"
+	// ActionUpdate update
+	ActionUpdate = "update"
+	// ActionDelete delete
+	ActionDelete = "delete"
+
+	// HookAllTables regist global hook
+	HookAllTables = "*"
+
+	hookBefore = "before:"
+	hookAfter  = "after:"
+)
+
+var (
+	hooks     = make(map[string][]Hook)
+	hooksLock sync.RWMutex
+)
+
+// HookContext data of insert, update, delete
+type HookContext struct {
+	Action string
+	Table  string
+
+	// Fields Values: Insert, Update
+	Fields []string
+	Values []interface{}
+	// DataSet: InsertM, UpdateM
+	DataSet *DataSet
+	// KeyField: UpdateM
+	KeyField string
+
+	Where string
+	Args  []interface{}
+
+	// Tx is nil if builder is not in a transaction
+	Tx       *Tx
+	Database *Database
+
+	// Result Err: after hooks only
+	Result sql.Result
+	Err    error
+}
+
+// Hook func, before hook returns error to veto the change
+type Hook func(ctx *HookContext) error
+
+// BeforeInsert regist hook, table: HookAllTables for all tables
+func BeforeInsert(table string, h Hook) {
+	addHook(hookBefore, ActionInsert, table, h)
+}
+
+// AfterInsert regist hook
+func AfterInsert(table string, h Hook) {
+	addHook(hookAfter, ActionInsert, table, h)
+}
+
+// BeforeUpdate regist hook
+func BeforeUpdate(table string, h Hook) {
+	addHook(hookBefore, ActionUpdate, table, h)
+}
+
+// AfterUpdate regist hook
+func AfterUpdate(table string, h Hook) {
+	addHook(hookAfter, ActionUpdate, table, h)
+}
+
+// BeforeDelete regist hook
+func BeforeDelete(table string, h Hook) {
+	addHook(hookBefore, ActionDelete, table, h)
+}
+
+// AfterDelete regist hook
+func AfterDelete(table string, h Hook) {
+	addHook(hookAfter, ActionDelete, table, h)
+}
+
+// ClearHooks remove all hooks
+func ClearHooks() {
+	hooksLock.Lock()
+	hooks = make(map[string][]Hook)
+	hooksLock.Unlock()
+}
+
+func hookKey(phase, action, table string) string {
+	return phase + action + ":" + table
+}
+
+func addHook(phase, action, table string, h Hook) {
+	if table == "" {
+		table = HookAllTables
+	}
+	key := hookKey(phase, action, table)
+	hooksLock.Lock()
+	hooks[key] = append(hooks[key], h)
+	hooksLock.Unlock()
+}
+
+// getHooks global hooks first
+func getHooks(phase, action, table string) []Hook {
+	hooksLock.RLock()
+	defer hooksLock.RUnlock()
+	all := hooks[hookKey(phase, action, HookAllTables)]
+	tbl := hooks[hookKey(phase, action, table)]
+	if len(tbl) == 0 {
+		return all
+	}
+	if len(all) == 0 {
+		return tbl
+	}
+	list := make([]Hook, 0, len(all)+len(tbl))
+	return append(append(list, all...), tbl...)
+}
+
+func hasHooks(action, table string) bool {
+	hooksLock.RLock()
+	defer hooksLock.RUnlock()
+	return len(hooks[hookKey(hookBefore, action, HookAllTables)]) > 0 ||
+		len(hooks[hookKey(hookAfter, action, HookAllTables)]) > 0 ||
+		len(hooks[hookKey(hookBefore, action, table)]) > 0 ||
+		len(hooks[hookKey(hookAfter, action, table)]) > 0
+}
+
+// newHookContext return nil if there is no hook
+func (b *Builder) newHookContext(action string) *HookContext {
+	if b.skipHooks || !hasHooks(action, b.table) {
+		return nil
+	}
+	return &HookContext{Action: action, Table: b.table, Tx: b.dbtx, Database: b.GetDatabase()}
+}
+
+// execWithHooks run before hooks, exec, then after hooks.
+// Hooks of a tenant builder out of transaction run in the implicit transaction with exec,
+// exec gets the builder bound to it.
+func (b *Builder) execWithHooks(hc *HookContext, exec func(b *Builder) (sql.Result, error)) (sql.Result, error) {
+	if hc == nil {
+		return exec(b)
+	}
+	if b.searchPath != "" && !b.isTx {
+		var r sql.Result
+		err := b.inTenantTx(func(tb *Builder) (err error) {
+			hc.Tx = tb.dbtx
+			r, err = tb.execWithHooks(hc, exec)
+			return err
+		})
+		return r, err
+	}
+	for _, h := range getHooks(hookBefore, hc.Action, hc.Table) {
+		if err := h(hc); err != nil {
+			return nil, err
+		}
+	}
+
+	hc.Result, hc.Err = exec(b)
+
+	for _, h := range getHooks(hookAfter, hc.Action, hc.Table) {
+		if err := h(hc); err != nil && hc.Err == nil {
+			return hc.Result, err
+		}
+	}
+	return hc.Result, hc.Err
+}
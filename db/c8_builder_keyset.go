@@ -0,0 +1,358 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kere/gno/libs/util"
+)
+
+var (
+	// ErrKeysetOrder keyset pagination without Order
+	ErrKeysetOrder = errors.New("keyset pagination requires Order")
+	// ErrKeysetLimit keyset pagination without Limit
+	ErrKeysetLimit = errors.New("keyset pagination requires Limit or Page")
+	// ErrCursor cursor can not be decoded, or its values do not match Order
+	ErrCursor = errors.New("invalid cursor")
+)
+
+// CursorPage page of keyset pagination
+type CursorPage struct {
+	DataSet DataSet
+	// Next cursor for After, Prev cursor for Before
+	Next string
+	Prev string
+	// HasNext, HasPrev in the direction of the query are known by one more row.
+	// The other side is true whenever a cursor is given, it is not queried,
+	// the rows there may have been deleted and the page of the cursor is empty.
+	HasNext bool
+	HasPrev bool
+}
+
+// Response for api: {"data": dataset, "next": cursor, "prev": cursor}
+func (p *CursorPage) Response() util.MapData {
+	return util.MapData{"data": &p.DataSet, "next": p.Next, "prev": p.Prev, "has_next": p.HasNext, "has_prev": p.HasPrev}
+}
+
+// orderKey column of order
+type orderKey struct {
+	column string
+	desc   bool
+}
+
+// parseOrder "a.date desc, id" -> [{a.date true} {id false}], commas in () are not separators
+func parseOrder(order string) []orderKey {
+	if order == "" {
+		return nil
+	}
+	arr := splitTopLevel(order)
+	keys := make([]orderKey, 0, len(arr))
+	for _, s := range arr {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		k := orderKey{column: s}
+		if i := strings.LastIndexAny(s, " \t\n"); i > -1 {
+			switch dir := s[i+1:]; {
+			case strings.EqualFold(dir, "desc"):
+				k.desc = true
+				k.column = strings.TrimSpace(s[:i])
+			case strings.EqualFold(dir, "asc"):
+				k.column = strings.TrimSpace(s[:i])
+			}
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// splitTopLevel split by commas out of () and quotes
+func splitTopLevel(str string) []string {
+	var arr []string
+	depth, begin := 0, 0
+	var quote byte
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			arr = append(arr, str[begin:i])
+			begin = i + 1
+		}
+	}
+	return append(arr, str[begin:])
+}
+
+// keysetErr cursor is invalid or order does not fit keyset pagination
+func (q *QueryBuilder) keysetErr() error {
+	if q.cursorErr != nil {
+		return q.cursorErr
+	}
+	if !q.isKeyset() {
+		return nil
+	}
+	keys := parseOrder(q.order)
+	for _, k := range keys {
+		if strings.IndexByte(k.column, '(') > -1 || strings.IndexAny(k.column, " \t\n") > -1 {
+			return errors.New("keyset pagination: order expression " + k.column + " is not supported")
+		}
+	}
+	if len(q.cursorVals) > 0 && len(q.cursorVals) != len(keys) {
+		return ErrCursor
+	}
+	for _, v := range q.cursorVals {
+		if v == nil {
+			return ErrCursor
+		}
+	}
+	return nil
+}
+
+// After rows after cursor, driven by Order columns. "" is the first page.
+func (q *QueryBuilder) After(cursor string) *QueryBuilder {
+	q.isBefore = false
+	q.cursorVals, q.cursorErr = DecodeCursor(cursor)
+	return q
+}
+
+// Before rows before cursor, the order is reversed in sql, and restored by QueryCursor.
+func (q *QueryBuilder) Before(cursor string) *QueryBuilder {
+	q.isBefore = true
+	q.cursorVals, q.cursorErr = DecodeCursor(cursor)
+	return q
+}
+
+// EncodeCursor values to opaque cursor
+func EncodeCursor(vals []interface{}) string {
+	n := len(vals)
+	arr := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		switch v := vals[i].(type) {
+		case []byte:
+			arr[i] = string(v)
+		case time.Time:
+			arr[i] = v.Format(time.RFC3339Nano)
+		default:
+			arr[i] = v
+		}
+	}
+	src, _ := json.Marshal(arr)
+	return base64.RawURLEncoding.EncodeToString(src)
+}
+
+// DecodeCursor opaque cursor to values, numbers are json.Number
+func DecodeCursor(cursor string) ([]interface{}, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	src, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrCursor
+	}
+	dec := json.NewDecoder(strings.NewReader(util.Bytes2Str(src)))
+	dec.UseNumber()
+	var vals []interface{}
+	if err = dec.Decode(&vals); err != nil {
+		return nil, ErrCursor
+	}
+	for i, v := range vals {
+		// json.Number as string parameter
+		if num, ok := v.(json.Number); ok {
+			vals[i] = string(num)
+		}
+	}
+	return vals, nil
+}
+
+// isKeyset After or Before is called
+func (q *QueryBuilder) isKeyset() bool {
+	return q.isBefore || len(q.cursorVals) > 0
+}
+
+// keyset where, args and order
+func (q *QueryBuilder) keyset() (string, []interface{}, string) {
+	keys := parseOrder(q.order)
+	order := q.order
+	if q.isBefore {
+		arr := make([]string, len(keys))
+		for i, k := range keys {
+			if k.desc {
+				arr[i] = k.column
+			} else {
+				arr[i] = k.column + sSortDesc
+			}
+		}
+		order = strings.Join(arr, util.SComma)
+	}
+	// the count is checked by keysetErr
+	if len(q.cursorVals) == 0 || len(q.cursorVals) != len(keys) {
+		return q.where, q.args, order
+	}
+
+	n := len(keys)
+	seq := len(q.args) + 1
+	args := make([]interface{}, 0, len(q.args)+n)
+	args = append(append(args, q.args...), q.cursorVals...)
+
+	// direction of each key, > is after for asc
+	ops := make([]string, n)
+	isSame := true
+	for i, k := range keys {
+		if k.desc != q.isBefore {
+			ops[i] = "<"
+		} else {
+			ops[i] = ">"
+		}
+		if ops[i] != ops[0] {
+			isSame = false
+		}
+	}
+
+	buf := strings.Builder{}
+	if q.where != "" {
+		buf.WriteByte('(')
+		buf.WriteString(q.where)
+		buf.WriteString(") AND ")
+	}
+	if isSame {
+		// (a,b) > ($1,$2)
+		buf.WriteByte('(')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(k.column)
+		}
+		buf.WriteString(")" + ops[0] + "(")
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(util.SDoller + strconv.Itoa(seq+i))
+		}
+		buf.WriteByte(')')
+		return buf.String(), args, order
+	}
+
+	// (a>$1 OR (a=$1 AND b<$2))
+	buf.WriteByte('(')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteString(" OR ")
+		}
+		buf.WriteByte('(')
+		for k := 0; k < i; k++ {
+			buf.WriteString(keys[k].column + "=" + util.SDoller + strconv.Itoa(seq+k) + " AND ")
+		}
+		buf.WriteString(keys[i].column + ops[i] + util.SDoller + strconv.Itoa(seq+i))
+		buf.WriteByte(')')
+	}
+	buf.WriteByte(')')
+	return buf.String(), args, order
+}
+
+// QueryCursor query page by After or Before cursor, Limit is the page size.
+// Order columns must be NOT NULL, the keyset comparison skips rows of NULL,
+// an error is returned if a NULL order value is read.
+func (q *QueryBuilder) QueryCursor() (CursorPage, error) {
+	if err := q.buildErr(); err != nil {
+		return CursorPage{}, err
+	}
+	keys := parseOrder(q.order)
+	if len(keys) == 0 {
+		return CursorPage{}, ErrKeysetOrder
+	}
+	pageSize := q.limit
+	if pageSize < 1 {
+		return CursorPage{}, ErrKeysetLimit
+	}
+
+	// one more row to know if there are more rows
+	limit, offset := q.limit, q.offset
+	q.limit, q.offset = pageSize+1, 0
+	ds, err := q.Query()
+	q.limit, q.offset = limit, offset
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	hasMore := ds.Len() > pageSize
+	n := len(ds.Columns)
+	for k := 0; k < n; k++ {
+		if hasMore {
+			ds.Columns[k] = ds.Columns[k][:pageSize]
+		}
+		if q.isBefore {
+			col := ds.Columns[k]
+			for i, j := 0, len(col)-1; i < j; i, j = i+1, j-1 {
+				col[i], col[j] = col[j], col[i]
+			}
+		}
+	}
+
+	page := CursorPage{DataSet: ds}
+	hasCursor := len(q.cursorVals) > 0
+	if q.isBefore {
+		page.HasPrev, page.HasNext = hasMore, hasCursor
+	} else {
+		page.HasNext, page.HasPrev = hasMore, hasCursor
+	}
+
+	l := ds.Len()
+	if l == 0 {
+		return page, nil
+	}
+	index := make([]int, len(keys))
+	for i, k := range keys {
+		// a.date -> date
+		name := k.column
+		if p := strings.LastIndexByte(name, '.'); p > -1 {
+			name = name[p+1:]
+		}
+		name = strings.Trim(name, `"`)
+		if index[i] = ds.FieldI(name); index[i] < 0 {
+			return page, errors.New("keyset pagination: order column " + name + " is not selected")
+		}
+		if hasNull(ds.Columns[index[i]]) {
+			return page, errors.New("keyset pagination: order column " + name + " is null")
+		}
+	}
+	if page.HasNext {
+		page.Next = EncodeCursor(cursorValues(&ds, l-1, index))
+	}
+	if page.HasPrev {
+		page.Prev = EncodeCursor(cursorValues(&ds, 0, index))
+	}
+	return page, nil
+}
+
+func cursorValues(ds *DataSet, i int, index []int) []interface{} {
+	vals := make([]interface{}, len(index))
+	for k, n := range index {
+		vals[k] = ds.Columns[n][i]
+	}
+	return vals
+}
+
+func hasNull(col []interface{}) bool {
+	for _, v := range col {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/valyala/bytebufferpool"
+)
+
+const (
+	// SearchWeb websearch_to_tsquery: "quoted phrase" or -exclude, postgres 11+
+	SearchWeb = 0
+	// SearchPlain plainto_tsquery: all words
+	SearchPlain = 1
+	// SearchPhrase phraseto_tsquery: words in order
+	SearchPhrase = 2
+	// SearchPrefix to_tsquery of word:* for search as you type
+	SearchPrefix = 3
+
+	defaultSearchConfig = "simple"
+)
+
+var (
+	// searchQuote text search is postgres only
+	searchQuote = &Postgres{}
+
+	searchConfigReg = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	searchFuncs     = []string{"websearch_to_tsquery", "plainto_tsquery", "phraseto_tsquery", "to_tsquery"}
+)
+
+// SearchOptions full-text search
+type SearchOptions struct {
+	// Config text search config, default simple
+	Config string
+	// Mode SearchWeb, SearchPlain, SearchPhrase, SearchPrefix
+	Mode int
+	// Weights A B C D of columns, same length as columns
+	Weights []string
+	// Rank order by ts_rank desc, before Order
+	Rank bool
+}
+
+// searchPart full-text predicate
+type searchPart struct {
+	vector string
+	fn     string
+	query  string
+	rank   bool
+}
+
+// Search full-text search of columns, an empty query is ignored.
+// Columns are quoted identifiers, a.title is "a"."title", names are case sensitive.
+// Create a GIN index with the same columns and options by CreateSearchIndex.
+// An invalid Config is returned by Query.
+func (q *QueryBuilder) Search(columns []string, query string, opts SearchOptions) *QueryBuilder {
+	q.searchErr = nil
+	if opts.Mode == SearchPrefix {
+		query = prefixTSQuery(query)
+	} else {
+		query = strings.TrimSpace(query)
+	}
+	if query == "" || len(columns) == 0 {
+		q.search = nil
+		return q
+	}
+	if opts.Mode < 0 || opts.Mode >= len(searchFuncs) {
+		opts.Mode = SearchWeb
+	}
+	cfg, err := searchConfig(opts.Config)
+	if err != nil {
+		q.search, q.searchErr = nil, err
+		return q
+	}
+	q.search = &searchPart{
+		vector: searchVector(columns, opts, cfg),
+		fn:     searchFuncs[opts.Mode] + "('" + cfg + "',",
+		query:  query,
+		rank:   opts.Rank,
+	}
+	return q
+}
+
+// write "vector @@ fn('config', $n)", n is the index of query in out
+func (s *searchPart) write(buf *bytebufferpool.ByteBuffer, out []interface{}) ([]interface{}, string) {
+	out = append(out, s.query)
+	tsquery := s.fn + "$" + strconv.Itoa(len(out)) + ")"
+	buf.WriteString(s.vector)
+	buf.WriteString(" @@ ")
+	buf.WriteString(tsquery)
+	return out, tsquery
+}
+
+// searchConfig regconfig name, it must be an identifier
+func searchConfig(name string) (string, error) {
+	if name == "" {
+		return defaultSearchConfig, nil
+	}
+	if !searchConfigReg.MatchString(name) {
+		return "", errors.New("db: invalid text search config " + name)
+	}
+	return name, nil
+}
+
+// SearchVector tsvector expression of columns, null columns are coalesced to empty text
+//
+//	to_tsvector('simple', coalesce("title",'') || ' ' || coalesce("body",''))
+func SearchVector(columns []string, opts SearchOptions) (string, error) {
+	cfg, err := searchConfig(opts.Config)
+	if err != nil {
+		return "", err
+	}
+	return searchVector(columns, opts, cfg), nil
+}
+
+// quoteSearchName "a.title" -> "a"."title"
+func quoteSearchName(buf *strings.Builder, name string) {
+	for i, s := range strings.Split(name, ".") {
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		searchQuote.WriteQuoteIdentifier(buf, s)
+	}
+}
+
+func searchVector(columns []string, opts SearchOptions, name string) string {
+	cfg := "'" + name + "'"
+	buf := strings.Builder{}
+	if len(opts.Weights) == len(columns) {
+		// setweight(to_tsvector('simple', coalesce(title,'')), 'A') || ...
+		for i, col := range columns {
+			if i > 0 {
+				buf.WriteString(" || ")
+			}
+			w := strings.ToUpper(opts.Weights[i])
+			if w != "A" && w != "B" && w != "C" {
+				w = "D"
+			}
+			buf.WriteString("setweight(to_tsvector(" + cfg + ", coalesce(")
+			quoteSearchName(&buf, col)
+			buf.WriteString(",'')), '" + w + "')")
+		}
+		return buf.String()
+	}
+
+	buf.WriteString("to_tsvector(" + cfg + ", ")
+	for i, col := range columns {
+		if i > 0 {
+			buf.WriteString(" || ' ' || ")
+		}
+		buf.WriteString("coalesce(")
+		quoteSearchName(&buf, col)
+		buf.WriteString(",'')")
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// prefixTSQuery "go lang" -> "go:* & lang:*"
+func prefixTSQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for i := range words {
+		words[i] += ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// SearchIndexSQL create GIN index sql for migrations
+func SearchIndexSQL(table string, columns []string, opts SearchOptions) (string, error) {
+	vector, err := SearchVector(columns, opts)
+	if err != nil {
+		return "", err
+	}
+	buf := strings.Builder{}
+	buf.WriteString("CREATE INDEX IF NOT EXISTS ")
+	searchQuote.WriteQuoteIdentifier(&buf, strings.NewReplacer(".", "_", `"`, "").Replace(table)+"_search_idx")
+	buf.WriteString(" ON ")
+	quoteSearchName(&buf, table)
+	buf.WriteString(" USING GIN ((" + vector + "))")
+	return buf.String(), nil
+}
+
+// CreateSearchIndex create GIN index, columns and opts must be the same as Search
+func (d *Database) CreateSearchIndex(table string, columns []string, opts SearchOptions) error {
+	sqlstr, err := SearchIndexSQL(table, columns, opts)
+	if err != nil {
+		return err
+	}
+	b := d.NewBuilder(table)
+	_, err = b.Exec(sqlstr, nil)
+	return err
+}
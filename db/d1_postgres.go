@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/kere/gno/libs/util"
+	"github.com/lib/pq"
 	"github.com/valyala/bytebufferpool"
 )
 
@@ -25,6 +27,21 @@ type Postgres struct {
 	Host     string
 	HostAddr string
 	Port     string
+
+	// SSLMode disable, require, verify-ca, verify-full; default disable
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	ApplicationName string
+	// ConnectTimeout seconds
+	ConnectTimeout string
+	// StatementTimeout milliseconds, run-time parameter of session
+	StatementTimeout string
+
+	// Params extra connection or run-time parameters
+	Params map[string]string
 }
 
 // Name f
@@ -67,21 +84,65 @@ func (p *Postgres) ConnectString() string {
 	if p.Port == "" {
 		p.Port = "5432"
 	}
+	sslmode := p.SSLMode
+	if sslmode == "" {
+		sslmode = "disable"
+	}
 
+	buf := bytebufferpool.Get()
+	writeConnParam(buf, "dbname", p.DBName)
+	writeConnParam(buf, "user", p.User)
+	writeConnParam(buf, "password", p.Password)
 	if p.HostAddr != "" {
-		return fmt.Sprintf("dbname=%s user=%s password=%s hostaddr=%s sslmode=disable",
-			p.DBName,
-			p.User,
-			p.Password,
-			p.HostAddr)
-
-	}
-	return fmt.Sprintf("dbname=%s user=%s password=%s host=%s port=%s sslmode=disable",
-		p.DBName,
-		p.User,
-		p.Password,
-		p.Host,
-		p.Port)
+		writeConnParam(buf, "hostaddr", p.HostAddr)
+	} else {
+		writeConnParam(buf, "host", p.Host)
+		writeConnParam(buf, "port", p.Port)
+	}
+	writeConnParam(buf, "sslmode", sslmode)
+	writeConnParam(buf, "sslrootcert", p.SSLRootCert)
+	writeConnParam(buf, "sslcert", p.SSLCert)
+	writeConnParam(buf, "sslkey", p.SSLKey)
+	writeConnParam(buf, "application_name", p.ApplicationName)
+	writeConnParam(buf, "connect_timeout", p.ConnectTimeout)
+	writeConnParam(buf, "statement_timeout", p.StatementTimeout)
+
+	keys := make([]string, 0, len(p.Params))
+	for k := range p.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeConnParam(buf, k, p.Params[k])
+	}
+
+	str := buf.String()
+	bytebufferpool.Put(buf)
+	return str
+}
+
+// writeConnParam key='value', empty value is skipped
+func writeConnParam(buf *bytebufferpool.ByteBuffer, key, val string) {
+	if val == "" {
+		return
+	}
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	if !strings.ContainsAny(val, ` '\`) {
+		buf.WriteString(val)
+		return
+	}
+	buf.WriteByte('\'')
+	for i := 0; i < len(val); i++ {
+		if val[i] == '\'' || val[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(val[i])
+	}
+	buf.WriteByte('\'')
 }
 
 // LastInsertID f
@@ -199,6 +260,183 @@ func (p *Postgres) IntsP(src []byte) ([]int, error) {
 	return doInts(src, true)
 }
 
+// Time parse timestamp, timestamptz, date, time, timetz.
+// time and timetz are on date 0000-01-01
+func (p *Postgres) Time(src []byte) (time.Time, error) {
+	if len(src) == 0 {
+		return time.Time{}, nil
+	}
+	str := util.Bytes2Str(src)
+	// 13:04:05.999999+08
+	if len(str) > 7 && str[2] == ':' {
+		return parseTimeOfDay(str)
+	}
+	return pq.ParseTimestamp(time.Local, str)
+}
+
+// parseTimeOfDay time or timetz
+func parseTimeOfDay(str string) (time.Time, error) {
+	layout := "15:04:05.999999999"
+	// zone: +08 +05:30 +05:30:15
+	if i := strings.LastIndexAny(str, "+-"); i > 7 && len(str)-i <= 9 {
+		layout += "-07:00:00"[:len(str)-i]
+	}
+	return time.ParseInLocation(layout, str, time.Local)
+}
+
+// Bool parse t, f, true, false
+func (p *Postgres) Bool(src []byte) (bool, error) {
+	switch util.Bytes2Str(src) {
+	case "t", "true", "TRUE", "y", "yes", "on", "1":
+		return true, nil
+	case "f", "false", "FALSE", "n", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("postgres bool: can not parse %s", src)
+}
+
+// HStore parse "a"=>"1", "b"=>NULL, NULL value is nil
+func (p *Postgres) HStore(src []byte) (util.MapData, error) {
+	m := util.MapData{}
+	l := len(src)
+	var key string
+	isKey := true
+	for i := 0; i < l; i++ {
+		switch src[i] {
+		case ' ', ',', '\t', '\n':
+			continue
+		case '=':
+			if i+1 >= l || src[i+1] != '>' || !isKey {
+				return nil, fmt.Errorf("postgres hstore: unexpected => at %d", i)
+			}
+			i++
+			isKey = false
+			continue
+		}
+
+		var v string
+		var isNull bool
+		if src[i] == '"' {
+			val, n, err := readPGQuoted(src[i:])
+			if err != nil {
+				return nil, err
+			}
+			v = val
+			i += n - 1
+		} else {
+			n := bytes.IndexAny(src[i:], ", =")
+			if n == -1 {
+				n = l - i
+			}
+			v = string(src[i : i+n])
+			isNull = !isKey && strings.EqualFold(v, "NULL")
+			i += n - 1
+		}
+
+		if isKey {
+			key = v
+			continue
+		}
+		if isNull {
+			m[key] = nil
+		} else {
+			m[key] = v
+		}
+		isKey = true
+	}
+	if !isKey {
+		return nil, fmt.Errorf("postgres hstore: missing value of %s", key)
+	}
+	return m, nil
+}
+
+// Range parse [1,10) (,5] empty ["2021-01-01 00:00:00","2021-02-01 00:00:00")
+func (p *Postgres) Range(src []byte) (Range, error) {
+	r := Range{}
+	l := len(src)
+	if l == 0 {
+		return r, nil
+	}
+	if strings.EqualFold(util.Bytes2Str(src), "empty") {
+		r.Empty = true
+		return r, nil
+	}
+	if l < 3 {
+		return r, fmt.Errorf("postgres range: can not parse %s", src)
+	}
+	switch src[0] {
+	case '[':
+		r.LowerInc = true
+	case '(':
+	default:
+		return r, fmt.Errorf("postgres range: can not parse %s", src)
+	}
+	switch src[l-1] {
+	case ']':
+		r.UpperInc = true
+	case ')':
+	default:
+		return r, fmt.Errorf("postgres range: can not parse %s", src)
+	}
+
+	body := src[1 : l-1]
+	var err error
+	var n int
+	if len(body) > 0 && body[0] == '"' {
+		r.Lower, n, err = readPGQuoted(body)
+		if err != nil {
+			return r, err
+		}
+	} else {
+		n = bytes.IndexByte(body, ',')
+		if n == -1 {
+			return r, fmt.Errorf("postgres range: can not parse %s", src)
+		}
+		r.Lower = string(body[:n])
+	}
+	r.LowerInf = n == 0
+
+	if n >= len(body) || body[n] != ',' {
+		return r, fmt.Errorf("postgres range: can not parse %s", src)
+	}
+	body = body[n+1:]
+	if len(body) > 0 && body[0] == '"' {
+		r.Upper, _, err = readPGQuoted(body)
+		if err != nil {
+			return r, err
+		}
+	} else {
+		r.Upper = string(body)
+	}
+	r.UpperInf = len(body) == 0
+	return r, nil
+}
+
+// readPGQuoted read "..." with \ escape, return value and bytes read
+func readPGQuoted(src []byte) (string, int, error) {
+	l := len(src)
+	buf := make([]byte, 0, l)
+	for i := 1; i < l; i++ {
+		switch src[i] {
+		case '\\':
+			i++
+			if i < l {
+				buf = append(buf, src[i])
+			}
+		case '"':
+			if i+1 < l && src[i+1] == '"' {
+				buf = append(buf, '"')
+				i++
+				continue
+			}
+			return string(buf), i + 1, nil
+		default:
+			buf = append(buf, src[i])
+		}
+	}
+	return "", l, fmt.Errorf("postgres: missing \" in %s", src)
+}
+
 func doInt64s(src []byte, isPool bool) ([]int64, error) {
 	if len(src) < 2 {
 		return nil, nil
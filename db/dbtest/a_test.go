@@ -0,0 +1,728 @@
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kere/gno/db"
+)
+
+func TestFake(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+
+	ds := db.NewDataSet([]string{"code", "price"})
+	ds.AddRow([]interface{}{"a001", 1.5})
+	f.On(`SELECT \* FROM stocks`).Return(ds)
+	f.On(`DELETE FROM "stocks"`).ReturnError(errors.New("denied"))
+	f.On(`UPDATE "stocks"`).RowsAffected(1)
+
+	// 1: query
+	q := db.Current().NewQuery("stocks")
+	dat, err := q.Where("code=$1", "a001").Query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dat.Len() != 1 || dat.Columns[0][0].(string) != "a001" || dat.Columns[1][0].(float64) != 1.5 {
+		db.PrintDataSet(&dat)
+		t.Fatal()
+	}
+	f.AssertExecuted(t, `SELECT \* FROM stocks WHERE code=\$1`, "a001")
+
+	// 2: exec error
+	del := db.Current().NewDelete("stocks")
+	if _, err = del.Where("code=$1", "a001").Delete(); err == nil || err.Error() != "denied" {
+		t.Fatal(err)
+	}
+
+	// 3: tx
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := tx.NewUpdate("stocks")
+	r, err := u.Where("code=$1", "a001").Update([]string{"price"}, []interface{}{2.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.RowsAffected(); n != 1 {
+		t.Fatal(n)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	f.AssertExecuted(t, `^UPDATE "stocks" SET "price"=\$2 WHERE code=\$1$`, "a001", 2.5)
+	f.AssertExecuted(t, SQLCommit)
+	f.AssertNotExecuted(t, SQLRollback)
+	f.AssertExpectations(t)
+
+	sts := f.Find(`UPDATE`)
+	if len(sts) != 1 || !sts[0].IsTx {
+		t.Fatal(sts)
+	}
+
+	// 4: strict
+	f.Strict = true
+	q = db.Current().NewQuery("users")
+	if _, err = q.Query(); err == nil {
+		t.Fatal("strict mode")
+	}
+}
+
+func TestDialect(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+	d := f.Database()
+	if d.Driver.Name() != db.DriverPSQL {
+		t.Fatal(d.Driver.Name())
+	}
+
+	if err := d.Notify("jobs", "1"); err != nil {
+		t.Fatal(err)
+	}
+	f.AssertExecuted(t, `pg_notify`, "jobs", "1")
+
+	f.SetDialect(db.DriverMySQL)
+	if d.Driver.Name() != db.DriverMySQL {
+		t.Fatal(d.Driver.Name())
+	}
+	if err := d.Notify("jobs", "1"); err != db.ErrListenNotSupported {
+		t.Fatal(err)
+	}
+	yes := db.NewDataSet([]string{"v"})
+	yes.AddRow([]interface{}{int64(1)})
+	f.On(`GET_LOCK`).Return(yes)
+	if ok, err := d.TryLock("cron"); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	f.AssertExecuted(t, `GET_LOCK\(\?, 0\)`, "cron")
+}
+
+func TestUpdateM(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+
+	cols := db.NewDataSet([]string{"code", "price", "vols"})
+	cols.Types = []db.ColType{{TypeName: "VARCHAR"}, {TypeName: "NUMERIC"}, {TypeName: "_INT4"}}
+	f.On(`LIMIT 0$`).Return(cols)
+	f.On(`^UPDATE "stocks"`).RowsAffected(2)
+
+	ds := db.NewDataSet([]string{"code", "price", "vols"})
+	ds.AddRow([]interface{}{"a001", 1.5, []int{1, 2}})
+	ds.AddRow([]interface{}{"a002", 2.5, []int{3}})
+	ds.AddRow([]interface{}{"a003", 3.5, []int{4}})
+
+	u := db.Current().NewUpdate("stocks")
+	u.Where("a.date=$1", 20210104)
+	r, err := u.UpdateM(&ds, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.RowsAffected(); n != 2 {
+		t.Fatal(n)
+	}
+	f.AssertExecuted(t, `^SELECT \* FROM "stocks" LIMIT 0$`)
+	f.AssertExecuted(t, `^UPDATE "stocks" AS a SET "price"=b."price","vols"=b."vols" FROM \(VALUES \(\$2::VARCHAR,\$3::NUMERIC,\$4::INT4\[\]\),\(\$5::VARCHAR,\$6::NUMERIC,\$7::INT4\[\]\),\(\$8::VARCHAR,\$9::NUMERIC,\$10::INT4\[\]\)\) AS b\("code","price","vols"\) WHERE a."code"=b."code" AND \(a.date=\$1\)$`,
+		20210104, "a001", 1.5, "{1,2}", "a002", 2.5, "{3}", "a003", 3.5, "{4}")
+
+	// column types are cached
+	f.Reset()
+	if err = u.UpdateMN(&ds, "code", 2); err != nil {
+		t.Fatal(err)
+	}
+	if sts := f.Find(`^UPDATE`); len(sts) != 2 || len(sts[1].Args) != 4 {
+		t.Fatal(sts)
+	}
+	if sts := f.Find(`LIMIT 0$`); len(sts) != 0 {
+		t.Fatal(sts)
+	}
+
+	// tenant has its own column types
+	f.Reset()
+	f.On(`LIMIT 0$`).Return(cols)
+	ut := f.Database().ForTenant("acme").NewUpdate("stocks")
+	if _, err = ut.UpdateM(&ds, "code"); err != nil {
+		t.Fatal(err)
+	}
+	if sts := f.Find(`LIMIT 0$`); len(sts) != 1 {
+		t.Fatal(sts)
+	}
+
+	// empty dataset
+	f.Reset()
+	db.Current().ClearColumnTypes()
+	empty := db.NewDataSet([]string{"code", "price"})
+	if err = u.UpdateMN(&empty, "code", 2); err != nil {
+		t.Fatal(err)
+	}
+	if sts := f.Find(``); len(sts) != 0 {
+		t.Fatal(sts)
+	}
+
+	f.Reset()
+	f.SetDialect(db.DriverMySQL)
+	f.On(`^UPDATE "stocks"`).RowsAffected(2)
+	u = db.Current().NewUpdate("stocks")
+	u.Where("date=?", 20210104)
+	ds.Columns[2] = []interface{}{"x", "y", "z"}
+	if _, err = u.UpdateM(&ds, "code"); err != nil {
+		t.Fatal(err)
+	}
+	if sts := f.Find(`LIMIT 0$`); len(sts) != 0 {
+		t.Fatal(sts)
+	}
+	f.AssertExecuted(t, `^UPDATE "stocks" SET "price"=CASE "code" WHEN \? THEN \? WHEN \? THEN \? WHEN \? THEN \? ELSE "price" END,"vols"=CASE "code" WHEN \? THEN \? WHEN \? THEN \? WHEN \? THEN \? ELSE "vols" END WHERE "code" IN \(\?,\?,\?\) AND \(date=\?\)$`,
+		"a001", 1.5, "a002", 2.5, "a003", 3.5, "a001", "x", "a002", "y", "a003", "z", "a001", "a002", "a003", 20210104)
+}
+
+func TestHooks(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+	defer db.ClearHooks()
+
+	var actions []string
+	db.AfterInsert(db.HookAllTables, func(ctx *db.HookContext) error {
+		actions = append(actions, ctx.Action+":"+ctx.Table)
+		return nil
+	})
+	db.BeforeDelete("stocks", func(ctx *db.HookContext) error {
+		return errors.New("delete is not allowed")
+	})
+	db.AfterUpdate("stocks", func(ctx *db.HookContext) error {
+		if ctx.Tx == nil || ctx.Err != nil {
+			return nil
+		}
+		ins := ctx.Tx.NewInsert("audit")
+		_, err := ins.SkipHooks().Insert([]string{"tbl", "cond"}, []interface{}{ctx.Table, ctx.Where})
+		return err
+	})
+
+	ins := db.Current().NewInsert("stocks")
+	if _, err := ins.Insert([]string{"code"}, []interface{}{"a001"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0] != "insert:stocks" {
+		t.Fatal(actions)
+	}
+
+	// veto
+	del := db.Current().NewDelete("stocks")
+	if _, err := del.Where("code=$1", "a001").Delete(); err == nil {
+		t.Fatal("delete should be vetoed")
+	}
+	f.AssertNotExecuted(t, `^DELETE`)
+
+	// audit in the same tx
+	tx, _ := db.BeginTx()
+	u := tx.NewUpdate("stocks")
+	if _, err := u.Where("code=$1", "a001").Update([]string{"price"}, []interface{}{1.5}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	sts := f.Find(`^INSERT INTO "audit"`)
+	if len(sts) != 1 || !sts[0].IsTx || sts[0].Args[1] != "code=$1" {
+		t.Fatal(sts)
+	}
+	if len(actions) != 1 {
+		t.Fatal(actions)
+	}
+}
+
+func TestLock(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+
+	yes := db.NewDataSet([]string{"pg_try_advisory_lock"})
+	yes.AddRow([]interface{}{true})
+	no := db.NewDataSet([]string{"pg_try_advisory_lock"})
+	no.AddRow([]interface{}{false})
+	f.On(`pg_try_advisory_lock`).Once().Return(no)
+	f.On(`pg_try_advisory_lock`).Return(yes)
+	f.On(`pg_advisory_unlock`).Return(yes)
+
+	d := f.Database()
+	ok, err := d.TryLock("cron")
+	if err != nil || ok {
+		t.Fatal(ok, err)
+	}
+
+	changes := make(chan bool, 2)
+	leader := d.NewLeader("cron", 10*time.Millisecond, func(isLeader bool) {
+		changes <- isLeader
+	})
+	leader.Start()
+	if v := <-changes; !v || !leader.IsLeader() {
+		t.Fatal("leader")
+	}
+	leader.Stop()
+	if v := <-changes; v || leader.IsLeader() {
+		t.Fatal("leader stop")
+	}
+	f.AssertExecuted(t, `pg_advisory_unlock`, db.LockKey("cron"))
+	if err = d.Unlock("cron"); err != db.ErrLockNotHeld {
+		t.Fatal(err)
+	}
+
+	// the connection is discarded if unlock fails
+	f.Reset()
+	f.On(`pg_try_advisory_lock`).Return(yes)
+	f.On(`pg_advisory_unlock`).ReturnError(errors.New("timeout"))
+	if ok, err = d.TryLock("cron"); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	open := d.DB().Stats().OpenConnections
+	if err = d.Unlock("cron"); err == nil {
+		t.Fatal("unlock should fail")
+	}
+	if n := d.DB().Stats().OpenConnections; n != open-1 {
+		t.Fatal("open connections", open, n)
+	}
+}
+
+func TestLockConcurrent(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+
+	yes := db.NewDataSet([]string{"v"})
+	yes.AddRow([]interface{}{true})
+	f.On(`pg_advisory_lock`).Return(yes)
+	f.On(`pg_advisory_unlock`).Return(yes)
+	d := f.Database()
+
+	var holders, count int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.Lock(context.Background(), "job"); err != nil {
+				t.Error(err)
+				return
+			}
+			if n := atomic.AddInt32(&holders, 1); n != 1 {
+				t.Error("holders", n)
+			}
+			if ok, err := d.TryLock("job"); ok || err != nil {
+				t.Error("try lock of held key", ok, err)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&count, 1)
+			atomic.AddInt32(&holders, -1)
+			if err := d.Unlock("job"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count != 20 {
+		t.Fatal(count)
+	}
+	if sts := f.Find(`pg_try_advisory_lock`); len(sts) != 0 {
+		t.Fatal(sts)
+	}
+	if sts := f.Find(`pg_advisory_unlock`); len(sts) != 20 {
+		t.Fatal(len(sts))
+	}
+
+	// waiting is canceled by ctx
+	if err := d.Lock(context.Background(), "job"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Lock(ctx, "job"); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if err := d.Unlock("job"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unlock("job"); err != db.ErrLockNotHeld {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryCursor(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+
+	ds := db.NewDataSet([]string{"id", "date"})
+	ds.AddRow([]interface{}{int64(3), "2021-01-03"})
+	ds.AddRow([]interface{}{int64(2), "2021-01-02"})
+	ds.AddRow([]interface{}{int64(1), "2021-01-01"})
+	f.On(`SELECT`).Once().Return(ds)
+
+	q := db.NewQuery("logs")
+	q.Where("uid=$1", 7).Order("date desc, id desc").Limit(2)
+	page, err := q.After("").QueryCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.DataSet.Len() != 2 || !page.HasNext || page.HasPrev || page.Next == "" {
+		t.Fatal(page)
+	}
+	f.AssertExecuted(t, `SELECT \* FROM logs WHERE uid=\$1 ORDER BY date desc, id desc LIMIT 3$`, 7)
+
+	vals, err := db.DecodeCursor(page.Next)
+	if err != nil || len(vals) != 2 || vals[0] != "2021-01-02" || vals[1] != "2" {
+		t.Fatal(vals, err)
+	}
+
+	ds2 := db.NewDataSet([]string{"id", "date"})
+	ds2.AddRow([]interface{}{int64(1), "2021-01-01"})
+	f.On(`SELECT`).Once().Return(ds2)
+	page, err = q.After(page.Next).QueryCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.DataSet.Len() != 1 || page.HasNext || !page.HasPrev || page.Prev == "" {
+		t.Fatal(page)
+	}
+	f.AssertExecuted(t, `WHERE \(uid=\$1\) AND \(date,id\)<\(\$2,\$3\) ORDER BY date desc, id desc LIMIT 3$`, 7, "2021-01-02", "2")
+
+	// before: reversed order, rows restored
+	ds3 := db.NewDataSet([]string{"id", "date"})
+	ds3.AddRow([]interface{}{int64(2), "2021-01-02"})
+	ds3.AddRow([]interface{}{int64(3), "2021-01-03"})
+	f.On(`SELECT`).Once().Return(ds3)
+	q = db.NewQuery("logs")
+	page, err = q.Order("date, id desc").Limit(2).Before(page.Prev).QueryCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.DataSet.Columns[0][0] != int64(3) || !page.HasNext || page.HasPrev {
+		t.Fatal(page)
+	}
+	f.AssertExecuted(t, `WHERE \(\(date<\$1\) OR \(date=\$1 AND id>\$2\)\) ORDER BY date desc,id LIMIT 3$`)
+
+	q = db.NewQuery("logs")
+	if _, err = q.After("!bad").QueryCursor(); err != db.ErrCursor {
+		t.Fatal(err)
+	}
+
+	// values of cursor do not match order
+	f.Reset()
+	cursor := db.EncodeCursor([]interface{}{"2021-01-02"})
+	q = db.NewQuery("logs")
+	q.Order("date, id").Limit(2).After(cursor)
+	if _, err = q.Query(); err != db.ErrCursor {
+		t.Fatal(err)
+	}
+	if _, err = q.QueryCursor(); err != db.ErrCursor {
+		t.Fatal(err)
+	}
+	if len(f.Statements()) != 0 {
+		t.Fatal(f.Statements())
+	}
+
+	// commas in expression
+	q = db.NewQuery("logs")
+	q.Order("coalesce(a, b) desc, id").Limit(2).After(cursor)
+	if _, err = q.QueryCursor(); err == nil || !strings.Contains(err.Error(), "coalesce(a, b)") {
+		t.Fatal(err)
+	}
+
+	// null order values
+	q = db.NewQuery("logs")
+	q.Order("date, id").Limit(2).After(db.EncodeCursor([]interface{}{nil, 2}))
+	if _, err = q.QueryCursor(); err != db.ErrCursor {
+		t.Fatal(err)
+	}
+	ds4 := db.NewDataSet([]string{"id", "date"})
+	ds4.AddRow([]interface{}{int64(1), nil})
+	f.On(`SELECT`).Once().Return(ds4)
+	q = db.NewQuery("logs")
+	if _, err = q.Order("date, id").Limit(2).After("").QueryCursor(); err == nil || !strings.Contains(err.Error(), "date is null") {
+		t.Fatal(err)
+	}
+}
+
+func TestTenant(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+
+	tn := f.Database().ForTenant(`acme"x`)
+	if tn.SearchPath() != `"acme""x"` {
+		t.Fatal(tn.SearchPath())
+	}
+
+	q := tn.NewQuery("users")
+	if _, err := q.Query(); err != nil {
+		t.Fatal(err)
+	}
+	u := tn.NewUpdate("users")
+	if _, err := u.Update([]string{"name"}, []interface{}{"tom"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sts := f.Statements()
+	expected := []string{SQLBegin, `SET LOCAL search_path TO "acme""x"`, "SELECT * FROM users", SQLCommit, SQLBegin}
+	for i, s := range expected {
+		if sts[i].SQL != s {
+			t.Fatal(i, sts[i].SQL)
+		}
+	}
+	f.AssertExecuted(t, `^UPDATE "users" SET`)
+
+	f.Reset()
+	tx, err := tn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins := tx.NewInsert("users")
+	ins.Insert([]string{"name"}, []interface{}{"tom"})
+	tx.Commit()
+	if sts = f.Statements(); len(sts) != 4 || !sts[2].IsTx || sts[3].SQL != SQLCommit {
+		t.Fatal(sts)
+	}
+
+	// hooks run in the implicit tx
+	defer db.ClearHooks()
+	var hookTx *db.Tx
+	db.BeforeDelete("users", func(ctx *db.HookContext) error {
+		hookTx = ctx.Tx
+		if ctx.Args[0] == "panic" {
+			panic("hook")
+		}
+		return nil
+	})
+	f.Reset()
+	del := tn.NewDelete("users")
+	if _, err = del.Where("name=$1", "tom").Delete(); err != nil || hookTx == nil {
+		t.Fatal(err, hookTx)
+	}
+	if sts = f.Statements(); len(sts) != 4 || !sts[2].IsTx || sts[3].SQL != SQLCommit {
+		t.Fatal(sts)
+	}
+
+	// the builder is not bound to the tx after a panic
+	f.Reset()
+	del.Where("name=$1", "panic")
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Fatal("hook should panic")
+			}
+		}()
+		del.Delete()
+	}()
+	if sts = f.Statements(); len(sts) != 3 || sts[2].SQL != SQLRollback {
+		t.Fatal(sts)
+	}
+	if del.GetTx() != nil {
+		t.Fatal("builder is bound to tx")
+	}
+
+	// default schema
+	f.Reset()
+	q = f.Database().ForTenant("").NewQuery("users")
+	q.Query()
+	if sts = f.Statements(); len(sts) != 1 {
+		t.Fatal(sts)
+	}
+}
+
+func TestQueryTyped(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	ds := db.NewDataSet([]string{"code", "price", "vol", "date", "memo"})
+	ds.Types = []db.ColType{{TypeName: "VARCHAR"}, {TypeName: "NUMERIC"}, {TypeName: "INT8"}, {TypeName: "TIMESTAMPTZ"}, {TypeName: "JSONB"}}
+	ds.AddRow([]interface{}{"a001", []byte("10.25"), int64(100), now, []byte(`{"a":1}`)})
+	ds.AddRow([]interface{}{"a002", nil, int64(200), now, nil})
+	f.On(`SELECT`).Return(ds)
+
+	q := db.NewQuery("stocks")
+	td, err := q.QueryTyped()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td.Len() != 2 {
+		t.Fatal(td.Len())
+	}
+	prices := td.Floats("price")
+	if len(prices) != 2 || prices[0] != 10.25 || !td.Column("price").IsNull(1) {
+		t.Fatal(prices)
+	}
+	if vols := td.Ints("vol"); vols[1] != 200 || td.Column("vol").Nulls != nil {
+		t.Fatal(vols)
+	}
+	if codes := td.Strings("code"); codes[1] != "a002" {
+		t.Fatal(codes)
+	}
+	if times := td.Times("date"); !times[0].Equal(now) {
+		t.Fatal(times)
+	}
+	if c := td.Column("memo"); c.Kind != db.KindAny || string(c.Values[0].([]byte)) != `{"a":1}` || !c.IsNull(1) {
+		t.Fatal(c)
+	}
+	// money is text of lc_monetary
+	if k := (db.ColType{TypeName: "money"}).Kind(); k != db.KindString {
+		t.Fatal(k)
+	}
+
+	back := td.DataSet()
+	if back.Columns[1][1] != nil || back.Columns[1][0] != 10.25 || back.Columns[2][0] != int64(100) {
+		t.Fatal(back.Columns)
+	}
+	td2 := db.NewTypedDataSet(&back)
+	if td2.Floats("price")[0] != 10.25 || !td2.Column("price").IsNull(1) || td2.Strings("code")[0] != "a001" {
+		t.Fatal(td2)
+	}
+
+	db.PutTypedDataSet(&td)
+}
+
+func TestImportCSV(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+
+	cols := db.NewDataSet([]string{"column_name", "data_type", "nullable", "max_length", "has_default"})
+	cols.AddRow([]interface{}{"code", "character varying", false, int64(6), false})
+	cols.AddRow([]interface{}{"price", "numeric", true, int64(0), false})
+	cols.AddRow([]interface{}{"date", "date", true, int64(0), false})
+	cols.AddRow([]interface{}{"vol", "bigint", false, int64(0), true})
+	f.On(`information_schema.columns`).Return(cols)
+	f.On(`\),\(`).Once().ReturnError(errors.New("duplicate key"))
+	// single row insert of retry
+	f.On(`INSERT INTO "stocks" \(code,price,date\) VALUES \(\$1,\$2,\$3\)$`).Once().ReturnError(errors.New("duplicate key"))
+
+	src := "Code,Price,Trade Date,Memo\n" +
+		"a001,10.5,2021-01-04,x\n" +
+		"a002,abc,2021-01-04,x\n" +
+		"a0000003,1,2021-01-04,x\n" +
+		"a004,2,2021-01-04,x\n" +
+		",2,,x\n" +
+		"a006,3,2021/01/05,x\n"
+	opts := db.ImportOptions{BatchSize: 2, Mapping: map[string]string{"Trade Date": "date"}}
+	result, err := f.Database().ImportCSVReader("stocks", strings.NewReader(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rows != 6 || result.Inserted != 2 || len(result.Rejected) != 4 {
+		t.Fatal(result)
+	}
+	if len(result.Ignored) != 1 || result.Ignored[0] != "Memo" || strings.Join(result.Columns, ",") != "code,price,date" {
+		t.Fatal(result.Ignored, result.Columns)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err = result.WriteReport(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "line,reason,Code,Price,Trade Date,Memo\n" +
+		"2,duplicate key,a001,10.5,2021-01-04,x\n" +
+		"3,\"price: strconv.ParseFloat: parsing \"\"abc\"\": invalid syntax\",a002,abc,2021-01-04,x\n" +
+		"4,code: value is longer than 6,a0000003,1,2021-01-04,x\n" +
+		"6,code: value is required,,2,,x\n"
+	if buf.String() != expected {
+		t.Fatal(buf.String())
+	}
+
+	// in tx, insert error rollbacks all
+	f.Reset()
+	f.On(`information_schema.columns`).Return(cols)
+	f.On(`INSERT INTO "stocks"`).ReturnError(errors.New("duplicate key"))
+	opts.InTx = true
+	result, err = f.Database().ImportCSVReader("stocks", strings.NewReader(src), opts)
+	if err == nil || result.Inserted != 0 {
+		t.Fatal(result, err)
+	}
+	f.AssertExecuted(t, SQLRollback)
+
+	// required column
+	f.Reset()
+	f.On(`information_schema.columns`).Return(cols)
+	if _, err = f.Database().ImportCSVReader("stocks", strings.NewReader("price\n1\n"), opts); err == nil {
+		t.Fatal("required column")
+	}
+
+	// default of empty vol, fields count
+	f.Reset()
+	f.On(`information_schema.columns`).Return(cols)
+	opts.InTx = false
+	src = "code,vol\na001,10\na002,\na003\na004,1,2\n"
+	result, err = f.Database().ImportCSVReader("stocks", strings.NewReader(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 2 || len(result.Rejected) != 2 || result.Rejected[0].Reason != "expected 2 fields, got 1" {
+		t.Fatal(result)
+	}
+	f.AssertExecuted(t, `^INSERT INTO "stocks" \(code\) VALUES \(\$1\)$`, "a002")
+	f.AssertExecuted(t, `^INSERT INTO "stocks" \("code","vol"\) VALUES`, "a001", int64(10))
+}
+
+func TestStats(t *testing.T) {
+	f := New("app")
+	defer f.Close()
+	d := f.Database()
+	d.EnableStats(true)
+
+	ds := db.NewDataSet([]string{"id"})
+	ds.AddRow([]interface{}{int64(1)})
+	ds.AddRow([]interface{}{int64(2)})
+	f.On(`SELECT`).Return(ds)
+	f.On(`DELETE`).ReturnError(errors.New("denied"))
+	f.On(`UPDATE`).RowsAffected(3)
+
+	for i := 0; i < 3; i++ {
+		q := d.NewQuery("users")
+		q.Where("id IN ($1,$2) AND name='tom'", i, i+1)
+		q.Query()
+	}
+	del := d.NewDelete("users")
+	del.Where("id=$1", 1).Delete()
+	u := d.NewUpdate("users")
+	u.Where("id=$1", 1).Update([]string{"name"}, []interface{}{"tom"})
+
+	stats := d.Stats()
+	if len(stats) != 3 {
+		t.Fatal(stats)
+	}
+	m := make(map[string]db.QueryStat)
+	for _, s := range stats {
+		m[s.SQL] = s
+	}
+	s := m["SELECT * FROM users WHERE id IN (?) AND name=?"]
+	if s.Count != 3 || s.Rows != 6 || s.Errors != 0 || s.P99 <= 0 || s.Avg <= 0 {
+		t.Fatal(stats)
+	}
+	if s = m[`DELETE FROM "users" WHERE id=?`]; s.Count != 1 || s.Errors != 1 {
+		t.Fatal(stats)
+	}
+
+	if fp := db.Fingerprint(`INSERT INTO "t" ("a","b") VALUES ($1,$2),($3,$4),($5,$6);`); fp != `INSERT INTO "t" ("a","b") VALUES (?)` {
+		t.Fatal(fp)
+	}
+
+	d.ResetStats()
+	if len(d.Stats()) != 0 {
+		t.Fatal(d.Stats())
+	}
+
+	// toggled while querying
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			d.EnableStats(i%2 == 0)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		q := d.NewQuery("users")
+		q.Query()
+	}
+	wg.Wait()
+	d.EnableStats(false)
+	if d.Stats() != nil {
+		t.Fatal(d.Stats())
+	}
+}
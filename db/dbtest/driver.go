@@ -0,0 +1,188 @@
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/kere/gno/db"
+)
+
+// DriverName database/sql driver name
+const DriverName = "dbtest"
+
+var (
+	fakes     = make(map[string]*Fake)
+	fakesLock sync.Mutex
+)
+
+func init() {
+	sql.Register(DriverName, fakeDriver{})
+}
+
+// fakeDriver database/sql driver, dsn is the Fake id
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fakesLock.Lock()
+	f, ok := fakes[dsn]
+	fakesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("dbtest: fake database %s not found", dsn)
+	}
+	return &fakeConn{fake: f}, nil
+}
+
+type fakeConn struct {
+	fake *Fake
+	inTx bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.fake.exec(SQLBegin, nil, false); err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return &fakeTx{conn: c}, nil
+}
+
+// CheckNamedValue accept any value, builders store values by IDriver.StoreData
+func (c *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err == nil {
+		nv.Value = v
+	}
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.fake.exec(query, namedArgs(args), c.inTx)
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.fake.query(query, namedArgs(args), c.inTx)
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (t *fakeTx) Commit() error {
+	t.conn.inTx = false
+	_, err := t.conn.fake.exec(SQLCommit, nil, true)
+	return err
+}
+
+func (t *fakeTx) Rollback() error {
+	t.conn.inTx = false
+	_, err := t.conn.fake.exec(SQLRollback, nil, true)
+	return err
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.fake.exec(s.query, valueArgs(args), s.conn.inTx)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.fake.query(s.query, valueArgs(args), s.conn.inTx)
+}
+
+func namedArgs(args []driver.NamedValue) []interface{} {
+	n := len(args)
+	vals := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		vals[i] = args[i].Value
+	}
+	return vals
+}
+
+func valueArgs(args []driver.Value) []interface{} {
+	n := len(args)
+	vals := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		vals[i] = args[i]
+	}
+	return vals
+}
+
+type fakeResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// fakeRows DataSet as driver.Rows
+type fakeRows struct {
+	ds db.DataSet
+	i  int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.ds.Fields
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(i int) string {
+	if i < len(r.ds.Types) {
+		return r.ds.Types[i].TypeName
+	}
+	return ""
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= r.ds.Len() {
+		return io.EOF
+	}
+	n := len(r.ds.Columns)
+	if len(dest) != n {
+		return errors.New("dbtest: columns.Len() != dest.Len()")
+	}
+	for k := 0; k < n; k++ {
+		v, err := driver.DefaultParameterConverter.ConvertValue(r.ds.Columns[k][r.i])
+		if err != nil {
+			v = fmt.Sprint(r.ds.Columns[k][r.i])
+		}
+		dest[k] = v
+	}
+	r.i++
+	return nil
+}
@@ -0,0 +1,335 @@
+// Package dbtest is a fake database for unit-testing code that uses the db builders.
+// It records the executed sql and args, and returns canned DataSet results or errors.
+//
+//	f := dbtest.New("app")
+//	f.On(`SELECT .* FROM users`).Return(ds)
+//	f.On(`UPDATE "users"`).RowsAffected(1)
+//	... call handlers
+//	f.AssertExecuted(t, `UPDATE "users" SET`, "tom")
+package dbtest
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kere/gno/db"
+	"github.com/kere/gno/libs/conf"
+	"github.com/kere/gno/libs/log"
+)
+
+const (
+	// SQLBegin recorded when a Tx begins
+	SQLBegin = "BEGIN"
+	// SQLCommit recorded when a Tx commits
+	SQLCommit = "COMMIT"
+	// SQLRollback recorded when a Tx rollbacks
+	SQLRollback = "ROLLBACK"
+)
+
+var (
+	fakeSeq int
+
+	// ErrUnexpected returned in strict mode when no expectation matches
+	ErrUnexpected = errors.New("dbtest: unexpected sql")
+
+	spaceReg = regexp.MustCompile(`\s+`)
+)
+
+// Statement executed sql
+type Statement struct {
+	SQL     string
+	Args    []interface{}
+	IsQuery bool
+	IsTx    bool
+}
+
+// Expect canned result of sql pattern
+type Expect struct {
+	pattern      *regexp.Regexp
+	ds           db.DataSet
+	err          error
+	rowsAffected int64
+	lastInsertID int64
+	times        int
+	called       int
+}
+
+// Return DataSet for query
+func (e *Expect) Return(ds db.DataSet) *Expect {
+	e.ds = ds
+	return e
+}
+
+// ReturnError for query and exec
+func (e *Expect) ReturnError(err error) *Expect {
+	e.err = err
+	return e
+}
+
+// RowsAffected for exec
+func (e *Expect) RowsAffected(n int64) *Expect {
+	e.rowsAffected = n
+	return e
+}
+
+// LastInsertID for exec
+func (e *Expect) LastInsertID(id int64) *Expect {
+	e.lastInsertID = id
+	return e
+}
+
+// Times match n times only, 0: unlimited
+func (e *Expect) Times(n int) *Expect {
+	e.times = n
+	return e
+}
+
+// Once match one time only
+func (e *Expect) Once() *Expect {
+	return e.Times(1)
+}
+
+// Called times
+func (e *Expect) Called() int {
+	return e.called
+}
+
+// Fake database
+type Fake struct {
+	// Strict return ErrUnexpected if no expectation matches
+	Strict bool
+
+	id         string
+	database   *db.Database
+	expects    []*Expect
+	statements []Statement
+	lock       sync.Mutex
+}
+
+// New fake database, regist it into db pool as current database
+func New(name string) *Fake {
+	fakesLock.Lock()
+	fakeSeq++
+	f := &Fake{id: fmt.Sprint(DriverName, fakeSeq)}
+	fakes[f.id] = f
+	fakesLock.Unlock()
+
+	f.database = db.NewDatabase(name, &Driver{Postgres: &db.Postgres{}, dsn: f.id}, conf.Conf{}, log.NewEmpty())
+	db.RegistDatabase(f.database)
+	return f
+}
+
+// Database of fake
+func (f *Fake) Database() *db.Database {
+	return f.database
+}
+
+// SetDialect emulate db.DriverPSQL or db.DriverMySQL
+func (f *Fake) SetDialect(name string) {
+	f.database.Driver.(*Driver).Dialect = name
+}
+
+// Close remove fake and close sql.DB
+func (f *Fake) Close() error {
+	fakesLock.Lock()
+	delete(fakes, f.id)
+	fakesLock.Unlock()
+	return f.database.DB().Close()
+}
+
+// On sql pattern (regexp), matched in registration order
+// the sql is matched after whitespaces are collapsed
+func (f *Fake) On(pattern string) *Expect {
+	e := &Expect{pattern: regexp.MustCompile(pattern)}
+	f.lock.Lock()
+	f.expects = append(f.expects, e)
+	f.lock.Unlock()
+	return e
+}
+
+// Statements executed
+func (f *Fake) Statements() []Statement {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	arr := make([]Statement, len(f.statements))
+	copy(arr, f.statements)
+	return arr
+}
+
+// Reset statements and expectations
+func (f *Fake) Reset() {
+	f.lock.Lock()
+	f.statements = nil
+	f.expects = nil
+	f.lock.Unlock()
+}
+
+// Find statements matched pattern
+func (f *Fake) Find(pattern string) []Statement {
+	reg := regexp.MustCompile(pattern)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var arr []Statement
+	for _, st := range f.statements {
+		if reg.MatchString(st.SQL) {
+			arr = append(arr, st)
+		}
+	}
+	return arr
+}
+
+// AssertExecuted fail if no statement matches pattern,
+// if args are given, they must equal the statement args
+func (f *Fake) AssertExecuted(t testing.TB, pattern string, args ...interface{}) {
+	t.Helper()
+	arr := f.Find(pattern)
+	if len(arr) == 0 {
+		t.Fatalf("dbtest: sql %s is not executed\n%s", pattern, f.dump())
+		return
+	}
+	if len(args) == 0 {
+		return
+	}
+	for _, st := range arr {
+		if equalArgs(st.Args, args) {
+			return
+		}
+	}
+	t.Fatalf("dbtest: sql %s is not executed with args %v\n%s", pattern, args, f.dump())
+}
+
+// AssertNotExecuted fail if any statement matches pattern
+func (f *Fake) AssertNotExecuted(t testing.TB, pattern string) {
+	t.Helper()
+	if len(f.Find(pattern)) > 0 {
+		t.Fatalf("dbtest: sql %s is executed\n%s", pattern, f.dump())
+	}
+}
+
+// AssertExpectations fail if any expectation is not called
+func (f *Fake) AssertExpectations(t testing.TB) {
+	t.Helper()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, e := range f.expects {
+		if e.called == 0 || (e.times > 0 && e.called < e.times) {
+			t.Fatalf("dbtest: expectation %s called %d times", e.pattern.String(), e.called)
+		}
+	}
+}
+
+func (f *Fake) dump() string {
+	buf := strings.Builder{}
+	buf.WriteString("executed:\n")
+	for _, st := range f.Statements() {
+		buf.WriteString(fmt.Sprintln("  ", st.SQL, st.Args))
+	}
+	return buf.String()
+}
+
+func (f *Fake) match(sqlstr string, args []interface{}, isQuery, isTx bool) *Expect {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.statements = append(f.statements, Statement{SQL: sqlstr, Args: args, IsQuery: isQuery, IsTx: isTx})
+	for _, e := range f.expects {
+		if e.times > 0 && e.called >= e.times {
+			continue
+		}
+		if e.pattern.MatchString(sqlstr) {
+			e.called++
+			return e
+		}
+	}
+	return nil
+}
+
+func (f *Fake) exec(query string, args []interface{}, isTx bool) (driver.Result, error) {
+	e := f.match(normalize(query), args, false, isTx)
+	if e == nil {
+		if f.Strict && !isTxStatement(query) {
+			return nil, ErrUnexpected
+		}
+		return fakeResult{}, nil
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return fakeResult{lastInsertID: e.lastInsertID, rowsAffected: e.rowsAffected}, nil
+}
+
+func (f *Fake) query(query string, args []interface{}, isTx bool) (driver.Rows, error) {
+	e := f.match(normalize(query), args, true, isTx)
+	if e == nil {
+		if f.Strict {
+			return nil, ErrUnexpected
+		}
+		return &fakeRows{}, nil
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &fakeRows{ds: e.ds}, nil
+}
+
+func isTxStatement(query string) bool {
+	return query == SQLBegin || query == SQLCommit || query == SQLRollback
+}
+
+func normalize(sqlstr string) string {
+	return strings.TrimSpace(spaceReg.ReplaceAllString(sqlstr, " "))
+}
+
+func equalArgs(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		va, _ := driver.DefaultParameterConverter.ConvertValue(a[i])
+		vb, err := driver.DefaultParameterConverter.ConvertValue(b[i])
+		if err != nil {
+			vb = b[i]
+		}
+		if ba, ok := va.([]byte); ok {
+			va = string(ba)
+		}
+		if bb, ok := vb.([]byte); ok {
+			vb = string(bb)
+		}
+		if !reflect.DeepEqual(va, vb) {
+			return false
+		}
+	}
+	return true
+}
+
+// Driver db.IDriver of fake, sql is written as postgres
+type Driver struct {
+	*db.Postgres
+	// Dialect emulated, default is db.DriverPSQL
+	Dialect string
+	dsn     string
+}
+
+// Name dialect emulated, dialect branches of db run as the real driver
+func (d *Driver) Name() string {
+	if d.Dialect == "" {
+		return db.DriverPSQL
+	}
+	return d.Dialect
+}
+
+// SQLDriverName database/sql driver name
+func (d *Driver) SQLDriverName() string {
+	return DriverName
+}
+
+// ConnectString fake id
+func (d *Driver) ConnectString() string {
+	return d.dsn
+}
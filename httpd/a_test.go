@@ -0,0 +1,774 @@
+package httpd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	golog "log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buaazp/fasthttprouter"
+	"github.com/fasthttp/websocket"
+	"github.com/kere/gno/libs/conf"
+	"github.com/kere/gno/libs/log"
+	"github.com/kere/gno/libs/util"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// newTestSite site without config file
+func newTestSite() *SiteServer {
+	DisablePageCache = true
+	s := &SiteServer{Name: "test", Router: fasthttprouter.New(), SiteData: &SiteData{ErrorURL: "/error", LoginURL: "/login"}}
+	s.Server = &fasthttp.Server{Handler: s.handle}
+	s.stopChan = make(chan struct{})
+	s.stopDone = make(chan struct{})
+	return s
+}
+
+// serveTest serve site in memory
+func serveTest(t *testing.T, s *SiteServer) *fasthttp.Client {
+	ln := listenTest(t, s)
+	return &fasthttp.Client{Dial: func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}}
+}
+
+// listenTest serve site by in memory listener
+func listenTest(t *testing.T, s *SiteServer) *fasthttputil.InmemoryListener {
+	ln := fasthttputil.NewInmemoryListener()
+	go s.Server.Serve(ln)
+	t.Cleanup(func() {
+		ln.Close()
+	})
+	return ln
+}
+
+// doTest request of method, form body is sent by post
+func doTest(t *testing.T, c *fasthttp.Client, method, uri, form string) *fasthttp.Response {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI("http://test" + uri)
+	req.Header.SetMethod(method)
+	if form != "" {
+		req.Header.SetContentType("application/x-www-form-urlencoded")
+		req.SetBodyString(form)
+	}
+	resp := &fasthttp.Response{}
+	if err := c.Do(req, resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// testPage page of funcs
+type testPage struct {
+	P
+	auth error
+	page func(ctx *fasthttp.RequestCtx) (interface{}, error)
+}
+
+func newTestPage(page func(ctx *fasthttp.RequestCtx) (interface{}, error)) *testPage {
+	p := &testPage{page: page}
+	p.PA.Body = testBody{}
+	return p
+}
+
+func (p *testPage) Auth(ctx *fasthttp.RequestCtx) error {
+	return p.auth
+}
+
+func (p *testPage) Page(ctx *fasthttp.RequestCtx) (interface{}, error) {
+	return p.page(ctx)
+}
+
+// testBody render data as text
+type testBody struct{}
+
+func (testBody) RenderD(w io.Writer, dat interface{}) error {
+	_, err := fmt.Fprint(w, "data:", dat)
+	return err
+}
+
+func TestTenant(t *testing.T) {
+	s := &SiteServer{}
+	s.SetTenantResolver(TenantFromHeader("X-Tenant"))
+	s.SetTenantValidator(TenantAllow("acme", "Foo"))
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.Set("X-Tenant", "FOO")
+	if !s.resolveTenant(ctx) || Tenant(ctx) != "foo" {
+		t.Fatal(Tenant(ctx))
+	}
+
+	ctx = &fasthttp.RequestCtx{}
+	ctx.Request.Header.Set("X-Tenant", "other")
+	if s.resolveTenant(ctx) || Tenant(ctx) != "" || ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+		t.Fatal(ctx.Response.StatusCode())
+	}
+
+	// no tenant
+	ctx = &fasthttp.RequestCtx{}
+	if !s.resolveTenant(ctx) || Tenant(ctx) != "" {
+		t.Fatal(Tenant(ctx))
+	}
+}
+
+func TestPagePost(t *testing.T) {
+	s := newTestSite()
+	form := newTestPage(func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		if FormValue(ctx, "name") == "" {
+			return nil, NewValidationError(nil).Add("name", "required")
+		}
+		return Redirect("/done?name=" + FormValue(ctx, "name")), nil
+	})
+	s.RegistPost("/form", form)
+	c := serveTest(t, s)
+
+	resp := doTest(t, c, fasthttp.MethodPost, "/form", "name=tom")
+	if resp.StatusCode() != fasthttp.StatusSeeOther || string(resp.Header.Peek("Location")) != "http://test/done?name=tom" {
+		t.Fatal(resp.StatusCode(), string(resp.Header.Peek("Location")))
+	}
+
+	resp = doTest(t, c, fasthttp.MethodPost, "/form", "name=&age=3")
+	if resp.StatusCode() != fasthttp.StatusUnprocessableEntity || !strings.Contains(string(resp.Body()), "name:required") || !strings.Contains(string(resp.Body()), "age:3") {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+}
+
+func TestPageAuth(t *testing.T) {
+	s := newTestSite()
+	c := serveTest(t, s)
+	p := newTestPage(func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		return nil, nil
+	})
+	p.auth = errors.New("no user")
+	p.PA.LoginURL = "/page/login"
+	s.RegistGet("/a", p)
+	s.RegistPost("/a", p)
+	s.Group("/admin").SetLoginURL("/admin/login").RegistGet("/a", p)
+
+	p2 := newTestPage(func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		return nil, nil
+	})
+	p2.auth = errors.New("no user")
+	s.RegistGet("/b", p2)
+	s.Group("/users").SetLoginURL("/users/login").RegistGet("/b", p2)
+
+	// login url of page, then group, then site
+	for uri, loginURL := range map[string]string{"/a": "/page/login", "/admin/a": "/page/login", "/b": "/login", "/users/b": "/users/login"} {
+		resp := doTest(t, c, fasthttp.MethodGet, uri, "")
+		if loc := string(resp.Header.Peek("Location")); resp.StatusCode() != fasthttp.StatusSeeOther || !strings.HasPrefix(loc, "http://test"+loginURL+"?") {
+			t.Fatal(uri, resp.StatusCode(), loc)
+		}
+	}
+	resp := doTest(t, c, fasthttp.MethodPost, "/a", "x=1")
+	if loc := string(resp.Header.Peek("Location")); !strings.HasPrefix(loc, "http://test/page/login?") {
+		t.Fatal(loc)
+	}
+}
+
+// traceMiddleware append name to X-Trace of response
+func traceMiddleware(name string) Middleware {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.Response.Header.Add("X-Trace", name)
+			next(ctx)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	s := newTestSite()
+	s.Use(traceMiddleware("site1"), traceMiddleware("site2"))
+	g := s.Group("/api", traceMiddleware("group"))
+	g.SetAuth(func(ctx *fasthttp.RequestCtx) error {
+		ctx.Response.Header.Add("X-Trace", "auth")
+		return nil
+	})
+	g.Group("/v1").RegistGet("/x", newTestPage(func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		ctx.Response.Header.Add("X-Trace", "handler")
+		return nil, nil
+	}), traceMiddleware("route"))
+	s.Use(func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			if ctx.QueryArgs().Has("panic") {
+				panic("site middleware")
+			}
+			next(ctx)
+		}
+	})
+	// Server.Handler is served without Start
+	c := serveTest(t, s)
+
+	resp := doTest(t, c, fasthttp.MethodGet, "/api/v1/x", "")
+	var trace []string
+	resp.Header.VisitAll(func(k, v []byte) {
+		if string(k) == "X-Trace" {
+			trace = append(trace, string(v))
+		}
+	})
+	if strings.Join(trace, ",") != "site1,site2,group,auth,route,handler" {
+		t.Fatal(trace)
+	}
+
+	resp = doTest(t, c, fasthttp.MethodGet, "/api/v1/x?panic=1", "")
+	if resp.StatusCode() != fasthttp.StatusInternalServerError {
+		t.Fatal(resp.StatusCode())
+	}
+}
+
+func TestGroup(t *testing.T) {
+	s := newTestSite()
+	ok := func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		return "ok", nil
+	}
+	admin := s.Group("/admin/", traceMiddleware("admin"))
+	admin.SetAuth(func(ctx *fasthttp.RequestCtx) error {
+		if ctx.QueryArgs().Has("user") {
+			return nil
+		}
+		return errors.New("no user")
+	}).SetLoginURL("/admin/login")
+	users := admin.Group("/users", traceMiddleware("users"))
+	users.RegistGet("/:id", newTestPage(ok))
+	users.NameRoute("user", "/:id")
+	if users.Prefix() != "/admin/users" {
+		t.Fatal(users.Prefix())
+	}
+	c := serveTest(t, s)
+
+	resp := doTest(t, c, fasthttp.MethodGet, "/admin/users/7?user=1", "")
+	if resp.StatusCode() != fasthttp.StatusOK || !strings.Contains(string(resp.Body()), "data:ok") {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+	var trace []string
+	resp.Header.VisitAll(func(k, v []byte) {
+		if string(k) == "X-Trace" {
+			trace = append(trace, string(v))
+		}
+	})
+	if strings.Join(trace, ",") != "admin,users" {
+		t.Fatal(trace)
+	}
+
+	// auth of group is inherited
+	resp = doTest(t, c, fasthttp.MethodGet, "/admin/users/7", "")
+	if loc := string(resp.Header.Peek("Location")); resp.StatusCode() != fasthttp.StatusSeeOther || !strings.HasPrefix(loc, "http://test/admin/login?") {
+		t.Fatal(resp.StatusCode(), loc)
+	}
+}
+
+func TestURL(t *testing.T) {
+	s := newTestSite()
+	Site = s
+	s.NameRoute("user", "/users/:id")
+	s.NameRoute("file", "/files/*path")
+
+	u, err := s.URL("user", map[string]interface{}{"id": 7, "tab": "info", "q": "a b"})
+	if err != nil || u != "/users/7?q=a+b&tab=info" {
+		t.Fatal(u, err)
+	}
+	if u, err = URL("file", "path", "/a b/c.txt"); err != nil || u != "/files/a%20b/c.txt" {
+		t.Fatal(u, err)
+	}
+	if u, err = URL("user", "id", "a/b"); err != nil || u != "/users/a%2Fb" {
+		t.Fatal(u, err)
+	}
+	if _, err = s.URL("user", nil); err == nil {
+		t.Fatal("param is required")
+	}
+	if _, err = s.URL("none", nil); err == nil {
+		t.Fatal("route is not found")
+	}
+	if _, err = URL("user", "id"); err == nil {
+		t.Fatal("pairs")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("name is already named")
+		}
+	}()
+	s.NameRoute("user", "/u/:id")
+}
+
+func TestAccessLog(t *testing.T) {
+	e := AccessEntry{
+		Time:      time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		Method:    "GET",
+		Path:      `/a.gif?q="x"`,
+		Proto:     "HTTP/1.1",
+		Status:    200,
+		Bytes:     2326,
+		Duration:  1.5,
+		IP:        "127.0.0.1",
+		UserID:    "12",
+		Referer:   "http://a.com/",
+		UserAgent: "Mozilla \\ \n",
+	}
+	if line := e.Format(AccessCommon); line != `127.0.0.1 - 12 [10/Oct/2000:13:55:36 -0700] "GET /a.gif?q=\"x\" HTTP/1.1" 200 2326 1500` {
+		t.Fatal(line)
+	}
+	if line := e.Format(AccessCombined); line != `127.0.0.1 - 12 [10/Oct/2000:13:55:36 -0700] "GET /a.gif?q=\"x\" HTTP/1.1" 200 2326 "http://a.com/" "Mozilla \\ \x0a" 1500` {
+		t.Fatal(line)
+	}
+	if line := e.Format(AccessJSON); !strings.HasPrefix(line, `{"time":"2000-10-10T13:55:36-07:00","method":"GET","path":"/a.gif?q=\"x\"",`) || !strings.Contains(line, `"duration_ms":1.5`) {
+		t.Fatal(line)
+	}
+	e.UserID, e.Bytes, e.Referer = "", 0, ""
+	if line := e.Format(AccessCombined); !strings.HasPrefix(line, `127.0.0.1 - - [`) || !strings.Contains(line, `200 - "-" "Mozilla`) {
+		t.Fatal(line)
+	}
+
+	// logger of caller is not changed
+	buf := bytes.NewBuffer(nil)
+	l := log.NewLogger("", "info")
+	l.Logger.SetOutput(buf)
+	l.Logger.SetFlags(golog.Ldate)
+	s := newTestSite()
+	s.Use(AccessLog(l, AccessCommon))
+	s.RegistGet("/a", newTestPage(func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		return nil, nil
+	}))
+	c := serveTest(t, s)
+	doTest(t, c, fasthttp.MethodGet, "/a?x=1", "")
+	if l.Logger.Flags() != golog.Ldate {
+		t.Fatal(l.Logger.Flags())
+	}
+	if line := buf.String(); !strings.Contains(line, ` "GET /a?x=1 HTTP/1.1" 200 `) || !strings.HasPrefix(line, "0.0.0.0 - - [") {
+		t.Fatal(line)
+	}
+}
+
+// testWS websocket methods
+type testWS struct{}
+
+func (testWS) Auth(ctx *fasthttp.RequestCtx) error {
+	return nil
+}
+
+func (testWS) Boom(args util.MapData) (interface{}, error) {
+	panic("boom")
+}
+
+func (testWS) Echo(args util.MapData) (interface{}, error) {
+	return args["v"], nil
+}
+
+func TestRecovery(t *testing.T) {
+	s := newTestSite()
+	boom := func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		panic("boom")
+	}
+	s.RegistGet("/error", newTestPage(func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		return "site error " + string(ctx.QueryArgs().Peek("msg")), nil
+	}))
+	s.RegistGet("/oops", newTestPage(func(ctx *fasthttp.RequestCtx) (interface{}, error) {
+		return "page error", nil
+	}))
+	s.RegistGet("/a", newTestPage(boom))
+	p := newTestPage(boom)
+	p.PA.ErrorURL = "/oops"
+	s.RegistPost("/b", p)
+	s.route(routeAPI, fasthttp.MethodGet, "/api", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("partial")
+		panic("boom")
+	}, nil)
+	s.RegistWS("/ws", testWS{})
+	ln := listenTest(t, s)
+	c := &fasthttp.Client{Dial: func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}}
+
+	resp := doTest(t, c, fasthttp.MethodGet, "/a", "")
+	if resp.StatusCode() != fasthttp.StatusInternalServerError || !strings.Contains(string(resp.Body()), "data:site error boom") {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+	resp = doTest(t, c, fasthttp.MethodPost, "/b", "x=1")
+	if resp.StatusCode() != fasthttp.StatusInternalServerError || !strings.Contains(string(resp.Body()), "data:page error") {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+	resp = doTest(t, c, fasthttp.MethodGet, "/api", "")
+	if resp.StatusCode() != fasthttp.StatusInternalServerError || strings.Contains(string(resp.Body()), "partial") {
+		t.Fatal(resp.StatusCode(), string(resp.Body()))
+	}
+
+	// websocket method panic is an error frame, the connection goes on
+	req := fasthttp.AcquireRequest()
+	req.SetRequestURI("http://test/ws")
+	req.Header.SetUserAgent("tester")
+	sign := buildWSSign(req)
+	fasthttp.ReleaseRequest(req)
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		return ln.Dial()
+	}}
+	ws, _, err := dialer.Dial("ws://test/ws?sign="+sign, map[string][]string{"User-Agent": {"tester"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	var reply map[string]interface{}
+	ws.WriteJSON(map[string]interface{}{"method": "testWSBoom"})
+	if err = ws.ReadJSON(&reply); err != nil || reply["iserror"] != true || reply["error"] != "testWSBoom: internal error" {
+		t.Fatal(reply, err)
+	}
+	ws.WriteJSON(map[string]interface{}{"method": "testWSEcho", "args": map[string]interface{}{"v": "hi"}})
+	if err = ws.ReadJSON(&reply); err != nil || reply["result"] != "hi" {
+		t.Fatal(reply, err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	s := newTestSite()
+	entered := make(chan struct{})
+	s.Router.GET("/slow", func(ctx *fasthttp.RequestCtx) {
+		close(entered)
+		time.Sleep(300 * time.Millisecond)
+	})
+	ln := fasthttputil.NewInmemoryListener()
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve(ln)
+	}()
+	c := &fasthttp.Client{Dial: func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}}
+	go c.Get(nil, "http://test/slow")
+	<-entered
+
+	var hooked bool
+	var hookErr error
+	s.OnShutdown(func(ctx context.Context) error {
+		hookErr = ctx.Err()
+		hooked = true
+		return nil
+	})
+
+	// drain times out, hooks have their own budget
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Stop(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatal("stop:", err)
+	}
+	if !hooked {
+		t.Fatal("stop returns before shutdown hooks")
+	}
+	if hookErr != nil {
+		t.Fatal("hook ctx:", hookErr)
+	}
+
+	select {
+	case e := <-served:
+		if e != nil {
+			t.Fatal(e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("serve does not return after stop")
+	}
+
+	if e := s.Stop(context.Background()); e != err {
+		t.Fatal("second stop:", e)
+	}
+}
+
+// errListener Accept fails
+type errListener struct {
+	net.Listener
+}
+
+func (errListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept")
+}
+
+func TestServeError(t *testing.T) {
+	s := newTestSite()
+	ln := errListener{fasthttputil.NewInmemoryListener()}
+	defer ln.Close()
+	n := runtime.NumGoroutine()
+	if err := s.serve(ln); err == nil {
+		t.Fatal("serve of closed listener")
+	}
+	// the goroutine closing ln on stop exits with serve
+	for i := 0; runtime.NumGoroutine() > n; i++ {
+		if i == 100 {
+			t.Fatal("goroutine leak", runtime.NumGoroutine(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeTestCert self-signed certificate of hosts
+func writeTestCert(t *testing.T, certFile, keyFile string, hosts ...string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTLSTestSite with certificates of a.test and b.test
+func newTLSTestSite(t *testing.T) (*SiteServer, string) {
+	dir := t.TempDir()
+	s := newTestSite()
+	for _, name := range []string{"a", "b"} {
+		cert, key := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+		writeTestCert(t, cert, key, name+".test")
+		s.AddCertificate(cert, key)
+	}
+	if err := s.certs.load(); err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func certHost(t *testing.T, s *SiteServer, serverName string) string {
+	cert, err := s.certs.getCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.DNSNames[0]
+}
+
+func TestCertificate(t *testing.T) {
+	s, dir := newTLSTestSite(t)
+
+	// SNI, the first one is the default
+	for name, host := range map[string]string{"a.test": "a.test", "b.test": "b.test", "c.test": "a.test", "": "a.test"} {
+		if h := certHost(t, s, name); h != host {
+			t.Fatal(name, "got", h)
+		}
+	}
+
+	if s.certs.isModified() {
+		t.Fatal("modified without change")
+	}
+	cert, key := filepath.Join(dir, "b.crt"), filepath.Join(dir, "b.key")
+	writeTestCert(t, cert, key, "c.test")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(cert, later, later)
+	if !s.certs.isModified() {
+		t.Fatal("change is not found")
+	}
+	if err := s.ReloadCertificates(); err != nil {
+		t.Fatal(err)
+	}
+	if h := certHost(t, s, "c.test"); h != "c.test" {
+		t.Fatal("reload: got", h)
+	}
+	if h := certHost(t, s, "b.test"); h != "a.test" {
+		t.Fatal("reload: got", h)
+	}
+
+	// bad file, current certificates are kept
+	os.WriteFile(cert, []byte("bad"), 0600)
+	if err := s.ReloadCertificates(); err == nil {
+		t.Fatal("bad certificate is loaded")
+	}
+	if h := certHost(t, s, "c.test"); h != "c.test" {
+		t.Fatal("failed reload: got", h)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	s, _ := newTLSTestSite(t)
+	s.Listen = ":8443"
+	s.RedirectListen = "127.0.0.1:0"
+	if err := s.startRedirect(); err != nil {
+		t.Fatal(err)
+	}
+	addr := s.redirectLn.Addr().String()
+	defer func() {
+		<-s.shutdownRedirect()
+	}()
+
+	c := &fasthttp.Client{Dial: func(string) (net.Conn, error) {
+		return net.Dial("tcp4", addr)
+	}}
+	do := func(host string) *fasthttp.Response {
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		req.SetRequestURI("http://" + host + "/a?b=1")
+		req.SetConnectionClose()
+		res := &fasthttp.Response{}
+		if err := c.Do(req, res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := do("b.test:80")
+	if res.StatusCode() != fasthttp.StatusMovedPermanently {
+		t.Fatal(res.StatusCode())
+	}
+	if loc := string(res.Header.Peek("Location")); loc != "https://b.test:8443/a?b=1" {
+		t.Fatal(loc)
+	}
+
+	// open redirect
+	if res = do("evil.test"); res.StatusCode() != fasthttp.StatusBadRequest {
+		t.Fatal("unknown host:", res.StatusCode(), string(res.Header.Peek("Location")))
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for str, rate := range map[string]float64{"10": 10, "10/s": 10, " 120/m": 2, "7200/h": 2} {
+		r, err := ParseRate(str)
+		if err != nil {
+			t.Fatal(str, err)
+		}
+		if r != rate {
+			t.Fatal(str, r)
+		}
+	}
+	for _, str := range []string{"", "0/s", "-1/s", "a/s", "10/d", "10/"} {
+		if _, err := ParseRate(str); err == nil {
+			t.Fatal("invalid rate is parsed:", str)
+		}
+	}
+}
+
+func TestMemoryRateStore(t *testing.T) {
+	m := NewMemoryRateStore()
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := m.Take("a", 10, 2); !ok {
+			t.Fatal("burst", i)
+		}
+	}
+	ok, wait, _ := m.Take("a", 10, 2)
+	if ok {
+		t.Fatal("bucket is not empty")
+	}
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Fatal("wait", wait)
+	}
+	// other keys have their own buckets
+	if ok, _, _ = m.Take("b", 10, 2); !ok {
+		t.Fatal("key b is limited")
+	}
+
+	time.Sleep(wait + 10*time.Millisecond)
+	if ok, _, _ = m.Take("a", 10, 2); !ok {
+		t.Fatal("token is not refilled")
+	}
+	if ok, _, _ = m.Take("a", 10, 2); ok {
+		t.Fatal("refill is more than rate")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	s := newTestSite()
+	s.Use(RateLimiter(RateLimit{Name: "test", Rate: 0.5, Burst: 1,
+		Key: RateKeyHeader("X-Api-Key", func(k string) bool { return k == "good" })}))
+	s.Router.GET("/x", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("ok")
+	})
+	c := serveTest(t, s)
+
+	doKey := func(key string) *fasthttp.Response {
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		req.SetRequestURI("http://test/x")
+		if key != "" {
+			req.Header.Set("X-Api-Key", key)
+		}
+		res := &fasthttp.Response{}
+		if err := c.Do(req, res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := doKey(""); res.StatusCode() != fasthttp.StatusOK {
+		t.Fatal(res.StatusCode())
+	}
+	res := doKey("")
+	if res.StatusCode() != fasthttp.StatusTooManyRequests {
+		t.Fatal(res.StatusCode())
+	}
+	if v := string(res.Header.Peek(fasthttp.HeaderRetryAfter)); v != "2" {
+		t.Fatal("Retry-After", v)
+	}
+
+	// invalid keys share the bucket of ip
+	if res = doKey("bad"); res.StatusCode() != fasthttp.StatusTooManyRequests {
+		t.Fatal("invalid key:", res.StatusCode())
+	}
+	if res = doKey("good"); res.StatusCode() != fasthttp.StatusOK {
+		t.Fatal("valid key:", res.StatusCode())
+	}
+}
+
+func TestRateKeyUser(t *testing.T) {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&fasthttp.Request{}, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)}, nil)
+	if k := RateKeyUser(ctx); k != "10.0.0.1" {
+		t.Fatal(k)
+	}
+	// auth is not called by the key
+	ctx.Request.Header.SetCookie(CookieNick, "tom")
+	if k := RateKeyUser(ctx); k != "10.0.0.1" {
+		t.Fatal(k)
+	}
+	ctx.SetUserValue(FieldUserID, 7)
+	if k := RateKeyUser(ctx); k != "u:7" {
+		t.Fatal(k)
+	}
+}
+
+func TestRateLimitConf(t *testing.T) {
+	newRateLimit(conf.Conf{"rate": "10/s", "key": "user"})
+	for _, c := range []conf.Conf{{"rate": "10/s", "key": "header:X-Api-Key"}, {"rate": "x"}} {
+		func() {
+			defer func() {
+				if p := recover(); p == nil {
+					t.Fatal("config should fail", c)
+				}
+			}()
+			newRateLimit(c)
+		}()
+	}
+	defer func() {
+		if p := recover(); p == nil {
+			t.Fatal("header key without validator")
+		}
+	}()
+	RateKeyHeader("X-Api-Key", nil)
+}
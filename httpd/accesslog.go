@@ -0,0 +1,165 @@
+package httpd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kere/gno/libs/conf"
+	"github.com/kere/gno/libs/log"
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// AccessCommon apache common log format, duration in microseconds is appended
+	AccessCommon = "common"
+	// AccessCombined apache combined log format, duration in microseconds is appended
+	AccessCombined = "combined"
+	// AccessJSON one json object per line
+	AccessJSON = "json"
+
+	accessTimeFormat = "02/Jan/2006:15:04:05 -0700"
+	accessEmpty      = "-"
+)
+
+// AccessEntry of access log
+type AccessEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	IP        string    `json:"ip"`
+	UserID    string    `json:"user_id,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// AccessLog middleware, log at info level of l, format: common, combined, json.
+// Lines are written to the output of l without prefix and flags, l is not changed.
+func AccessLog(l *log.Logger, format string) Middleware {
+	switch format {
+	case AccessCommon, AccessJSON:
+	default:
+		format = AccessCombined
+	}
+
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			now := time.Now()
+			next(ctx)
+			if !l.IsLevel(log.LogInfo) {
+				return
+			}
+			e := newAccessEntry(ctx, now)
+			// entries have their own time, the line is written without flags of l
+			l.Logger.Writer().Write([]byte(e.Format(format) + "\n"))
+		}
+	}
+}
+
+// newAccessLog by config section: format, logname, logstore, level
+func newAccessLog(c conf.Conf) Middleware {
+	l := log.New("var/log/", c.DefaultString("logname", "access"), c.DefaultString("logstore", log.StoreTypeStd), c.DefaultString("level", "info"))
+	return AccessLog(l, c.DefaultString("format", AccessCombined))
+}
+
+func newAccessEntry(ctx *fasthttp.RequestCtx, start time.Time) AccessEntry {
+	e := AccessEntry{
+		Time:      start,
+		Method:    string(ctx.Method()),
+		Path:      string(ctx.RequestURI()),
+		Proto:     "HTTP/1.0",
+		Status:    ctx.Response.StatusCode(),
+		Bytes:     ctx.Response.Header.ContentLength(),
+		Duration:  float64(time.Since(start).Microseconds()) / 1000,
+		IP:        ctx.RemoteIP().String(),
+		Referer:   string(ctx.Request.Header.Referer()),
+		UserAgent: string(ctx.Request.Header.UserAgent()),
+	}
+	if ctx.Request.Header.IsHTTP11() {
+		e.Proto = "HTTP/1.1"
+	}
+	if e.Bytes < 0 {
+		e.Bytes = len(ctx.Response.Body())
+	}
+	if uid := ctx.UserValue(FieldUserID); uid != nil {
+		e.UserID = fmt.Sprint(uid)
+	}
+	return e
+}
+
+// Format line of common, combined or json
+func (e *AccessEntry) Format(format string) string {
+	if format == AccessJSON {
+		src, err := json.Marshal(e)
+		if err != nil {
+			return err.Error()
+		}
+		return string(src)
+	}
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	// 127.0.0.1 - 12 [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326
+	buf.WriteString(e.IP)
+	buf.WriteString(" - ")
+	buf.WriteString(accessValue(e.UserID))
+	buf.WriteString(" [")
+	buf.WriteString(e.Time.Format(accessTimeFormat))
+	buf.WriteString("] \"")
+	buf.WriteString(e.Method)
+	buf.WriteByte(' ')
+	writeAccessQuoted(buf, e.Path)
+	buf.WriteByte(' ')
+	buf.WriteString(e.Proto)
+	buf.WriteString("\" ")
+	buf.WriteString(strconv.Itoa(e.Status))
+	buf.WriteByte(' ')
+	if e.Bytes == 0 {
+		buf.WriteString(accessEmpty)
+	} else {
+		buf.WriteString(strconv.Itoa(e.Bytes))
+	}
+
+	if format == AccessCombined {
+		buf.WriteString(" \"")
+		writeAccessQuoted(buf, accessValue(e.Referer))
+		buf.WriteString("\" \"")
+		writeAccessQuoted(buf, accessValue(e.UserAgent))
+		buf.WriteByte('"')
+	}
+
+	// %D
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(int64(e.Duration*1000), 10))
+	return buf.String()
+}
+
+func accessValue(s string) string {
+	if s == "" {
+		return accessEmpty
+	}
+	return s
+}
+
+// writeAccessQuoted escape " \ and control chars
+func writeAccessQuoted(buf *bytebufferpool.ByteBuffer, s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			buf.WriteString(fmt.Sprintf("\\x%02x", c))
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package httpd
+
+import (
+	"encoding/json"
+	"html/template"
+
+	"github.com/kere/gno/db"
+	"github.com/valyala/fasthttp"
+)
+
+const dbStatsHTML = `<!DOCTYPE HTML>
+<html><head><meta charset="utf-8"><title>db stats</title>
+<style>body{font:13px monospace}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:3px 6px;text-align:right}td.sql{text-align:left;max-width:900px;word-break:break-all}</style>
+</head><body>
+<form method="post"><p>{{.Name}} &nbsp; <a href="?format=json">json</a> &nbsp; <button name="reset" value="1">reset</button></p></form>
+<table><tr><th>sql</th><th>count</th><th>total</th><th>avg</th><th>p99</th><th>max</th><th>rows</th><th>errors</th></tr>
+{{range .Stats}}<tr><td class="sql">{{.SQL}}</td><td>{{.Count}}</td><td>{{.Total}}</td><td>{{.Avg}}</td><td>{{.P99}}</td><td>{{.Max}}</td><td>{{.Rows}}</td><td>{{.Errors}}</td></tr>
+{{end}}</table></body></html>`
+
+var dbStatsTemplate = template.Must(template.New("dbstats").Parse(dbStatsHTML))
+
+// RegistDBStats query statistics page of current database, dev mode only.
+// ?format=json for json, POST to clear. Enable stats by [db] stats=true
+func (s *SiteServer) RegistDBStats(rule string, mw ...Middleware) {
+	s.route(routeAPI, fasthttp.MethodPost, rule, func(ctx *fasthttp.RequestCtx) {
+		if RunMode != ModeDev {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+		db.Current().ResetStats()
+		ctx.Redirect(string(ctx.Path()), fasthttp.StatusSeeOther)
+	}, mw)
+
+	s.route(routeAPI, fasthttp.MethodGet, rule, func(ctx *fasthttp.RequestCtx) {
+		if RunMode != ModeDev {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+			return
+		}
+		d := db.Current()
+		args := ctx.QueryArgs()
+		stats := d.Stats()
+		if string(args.Peek("format")) == "json" {
+			src, err := json.Marshal(stats)
+			if err != nil {
+				ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+				return
+			}
+			ctx.SetContentType("application/json; charset=utf-8")
+			ctx.Write(src)
+			return
+		}
+
+		ctx.SetContentTypeBytes(contentTypePage)
+		err := dbStatsTemplate.Execute(ctx, map[string]interface{}{"Name": d.Name, "Stats": stats})
+		if err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		}
+	}, mw)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/kere/gno/httpd/example/app/page"
 	"github.com/kere/gno/httpd/example/app/upload"
 	"github.com/kere/gno/httpd/example/app/websock"
+	"github.com/kere/gno/libs/log"
 )
 
 func main() {
@@ -18,7 +19,9 @@ func main() {
 
 	httpd.Site.RegistWS("/ws", websock.NewWS())
 	httpd.Site.RegistUpload("/upload/app", upload.NewImage())
+	httpd.Site.RegistDBStats("/dev/dbstats")
 
 	// httpd.RunMode = httpd.ModePro
 	httpd.Site.Start()
+	log.CloseAll()
 }
@@ -0,0 +1,145 @@
+package httpd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/kere/gno/db"
+	"github.com/kere/gno/libs/cache"
+	"github.com/kere/gno/libs/log"
+)
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// StartHook run before listen, an error stops Start
+type StartHook func(s *SiteServer) error
+
+// ShutdownHook run after requests are drained, before pools are closed
+type ShutdownHook func(ctx context.Context) error
+
+// OnStart add start hook
+func (s *SiteServer) OnStart(f StartHook) {
+	s.startHooks = append(s.startHooks, f)
+}
+
+// OnShutdown add shutdown hook, hooks run in reverse order
+func (s *SiteServer) OnShutdown(f ShutdownHook) {
+	s.shutdownHooks = append(s.shutdownHooks, f)
+}
+
+func (s *SiteServer) runStartHooks() error {
+	for _, f := range s.startHooks {
+		if err := f(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop graceful shutdown: websockets are closed with close frame,
+// in-flight requests are drained until ctx is done, then shutdown hooks run
+// with their own ShutdownTimeout, db and redis pools are closed.
+// If the drain times out, pools are left open for the requests still running.
+// Log files are shared by the process, they are left to the caller: log.CloseAll after Start returns.
+// Start returns after Stop is done. A second Stop waits and returns the
+// result of the first one.
+func (s *SiteServer) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		s.stopErr = s.stop(ctx)
+	})
+	return s.stopErr
+}
+
+func (s *SiteServer) stop(ctx context.Context) error {
+	if s.stopDone != nil {
+		defer close(s.stopDone)
+	}
+	if s.stopChan != nil {
+		close(s.stopChan)
+	}
+	s.closeWebsockets()
+
+	// drain
+	done := make(chan error, 1)
+	go func() {
+		redirectDone := s.shutdownRedirect()
+		err := s.Server.Shutdown()
+		<-redirectDone
+		done <- err
+	}()
+	var err error
+	drained := true
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		drained = false
+		log.App.Warn("shutdown: drain timeout, requests are cut off")
+	}
+
+	hctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+	for i := len(s.shutdownHooks) - 1; i > -1; i-- {
+		if e := s.shutdownHooks[i](hctx); e != nil {
+			log.App.Error("shutdown hook:", e)
+			if err == nil {
+				err = e
+			}
+		}
+	}
+
+	if s.PID != "" {
+		os.Remove(s.PID)
+	}
+
+	if drained {
+		if e := db.CloseAll(); e != nil {
+			log.App.Error("shutdown: close db", e)
+		}
+		cache.Close()
+	} else {
+		log.App.Warn("shutdown: db and redis pools are left open")
+	}
+
+	if err != nil {
+		log.App.Error("shutdown:", err)
+	}
+	return err
+}
+
+func (s *SiteServer) shutdownTimeout() time.Duration {
+	if s.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return s.ShutdownTimeout
+}
+
+// stopBySignal Stop with ShutdownTimeout
+func (s *SiteServer) stopBySignal(sign os.Signal) {
+	log.App.Notice("shutdown by signal:", sign)
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+	s.Stop(ctx)
+}
+
+// trackWS websocket connection until it is closed
+func (s *SiteServer) trackWS(ws *websocket.Conn) func() {
+	s.wsConns.Store(ws, struct{}{})
+	return func() {
+		s.wsConns.Delete(ws)
+	}
+}
+
+// closeWebsockets send close frame, read loops exit on the reply or error
+func (s *SiteServer) closeWebsockets() {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	deadline := time.Now().Add(time.Second)
+	s.wsConns.Range(func(k, v interface{}) bool {
+		ws := k.(*websocket.Conn)
+		ws.WriteControl(websocket.CloseMessage, msg, deadline)
+		ws.SetReadDeadline(deadline)
+		return true
+	})
+}
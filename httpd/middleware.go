@@ -0,0 +1,34 @@
+package httpd
+
+import (
+	"github.com/valyala/fasthttp"
+)
+
+// Middleware wrap handler, call next to continue
+type Middleware func(next fasthttp.RequestHandler) fasthttp.RequestHandler
+
+// Use middleware for all requests, the first one is the outermost.
+// Call Use before the server is serving.
+func (s *SiteServer) Use(mw ...Middleware) {
+	s.middlewares = append(s.middlewares, mw...)
+	// recover panics of site middleware
+	s.handler = s.recovery(routeAPI, nil)(Chain(s.dispatch, s.middlewares...))
+}
+
+// Chain handler with middleware, the first one is the outermost
+func Chain(h fasthttp.RequestHandler, mw ...Middleware) fasthttp.RequestHandler {
+	for i := len(mw) - 1; i > -1; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// route register handler with route middleware, panics are recovered by kind
+func (s *SiteServer) route(kind int, method, path string, h fasthttp.RequestHandler, mw []Middleware) {
+	s.Router.Handle(method, path, s.recovery(kind, nil)(Chain(h, mw...)))
+}
+
+// routePage register page handler, panics are responded by error page of page
+func (s *SiteServer) routePage(method, path string, p IPage, h fasthttp.RequestHandler, mw []Middleware) {
+	s.Router.Handle(method, path, s.recovery(routePage, p.Attr())(Chain(h, mw...)))
+}
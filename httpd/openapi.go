@@ -56,7 +56,7 @@ type IOpenAPI interface {
 type apiExec func(ctx *fasthttp.RequestCtx, args util.MapData) (interface{}, error)
 
 // RegistOpenAPI init open api
-func (s *SiteServer) RegistOpenAPI(rule string, openapi IOpenAPI) {
+func (s *SiteServer) RegistOpenAPI(rule string, openapi IOpenAPI, mw ...Middleware) {
 	v := reflect.ValueOf(openapi)
 	typ := v.Type()
 	l := typ.NumMethod()
@@ -68,13 +68,13 @@ func (s *SiteServer) RegistOpenAPI(rule string, openapi IOpenAPI) {
 
 		openapiMap[rule+Slash+m.Name] = v.Method(i).Interface().(func(ctx *fasthttp.RequestCtx, args util.MapData) (interface{}, error))
 
-		s.Router.POST(rule+Slash+m.Name, func(ctx *fasthttp.RequestCtx) {
+		s.route(routeAPI, fasthttp.MethodPost, rule+Slash+m.Name, func(ctx *fasthttp.RequestCtx) {
 			if err := openapi.Auth(ctx); err != nil {
 				doAPIError(ctx, err)
 				return
 			}
 			openAPIHandle(ctx)
-		})
+		}, mw)
 	}
 }
 
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"net/http"
 
-	"github.com/kere/gno/libs/log"
 	"github.com/kere/gno/libs/util"
 	"github.com/valyala/fasthttp"
 )
@@ -23,20 +22,6 @@ func openAPIHandle(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	if RunMode == ModePro {
-		defer func() {
-			if p := recover(); p != nil {
-				str, isok := p.(string)
-				var err error
-				if isok {
-					err = errors.New(str)
-				} else {
-					err = errors.New("panic")
-				}
-				log.App.Warn(err)
-			}
-		}()
-	}
 	// Auth
 
 	// application/x-www-form-urlencoded;charset=UTF-8
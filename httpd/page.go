@@ -80,32 +80,35 @@ func (p *P) Auth(ctx *fasthttp.RequestCtx) error {
 	return nil
 }
 
-// RegistGet router
-func (s *SiteServer) RegistGet(rule string, p IPage) {
-	s.Router.GET(rule, func(ctx *fasthttp.RequestCtx) {
+// RegistGet router, mw: route middleware
+func (s *SiteServer) RegistGet(rule string, p IPage, mw ...Middleware) {
+	s.routePage(fasthttp.MethodGet, rule, p, s.pageHandler(p, false, ""), mw)
+}
+
+// RegistPost router, form values are read by Form(ctx) in Page.
+// Page returns Redirect(url) for post-redirect-get,
+// or a *ValidationError to render the page again with status 422.
+// If Auth fails, it is redirected to PageAttr.LoginURL, then login url of group or site.
+func (s *SiteServer) RegistPost(rule string, p IPage, mw ...Middleware) {
+	s.routePage(fasthttp.MethodPost, rule, p, s.pageHandler(p, true, ""), mw)
+}
+
+// pageHandler Auth -> Page -> renderPage, loginURL: login url of group
+func (s *SiteServer) pageHandler(p IPage, isPost bool, loginURL string) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
 		pa := p.Attr()
 		pa.SiteData = s.SiteData
 		// do auth
 		err := p.Auth(ctx)
 		if err != nil {
-			var loginURL string
-			if len(loginURL) == 0 {
-				loginURL = pa.SiteData.LoginURL
-			} else {
-				loginURL = pa.LoginURL
-			}
-			u, _ := url.Parse(loginURL)
-			dat := u.Query()
-			dat.Add(sAuthURL, string(ctx.RequestURI()))
-			u.RawQuery = dat.Encode()
-			ctx.Redirect(u.String(), fasthttp.StatusSeeOther)
+			doAuthErr(pa, ctx, loginURL)
 			return
 		}
 
 		ctx.SetContentTypeBytes(contentTypePage)
 
 		// try cache
-		if TryCache(ctx, p) {
+		if !isPost && TryCache(ctx, p) {
 			tryStaticHTML(ctx, p)
 			return
 		}
@@ -113,7 +116,18 @@ func (s *SiteServer) RegistGet(rule string, p IPage) {
 		// do page
 		pdat, err := p.Page(ctx)
 		if err != nil {
-			doPageErr(pa, ctx, err)
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				doPageErr(pa, ctx, err)
+				return
+			}
+			// render again with errors
+			ctx.SetStatusCode(fasthttp.StatusUnprocessableEntity)
+			pdat = verr.PageData(ctx)
+		}
+
+		if r, ok := pdat.(*PageRedirect); ok {
+			ctx.Redirect(r.URL, r.Status)
 			return
 		}
 
@@ -125,6 +139,10 @@ func (s *SiteServer) RegistGet(rule string, p IPage) {
 			return
 		}
 
+		if isPost || ctx.Response.StatusCode() != fasthttp.StatusOK {
+			return
+		}
+
 		tryStaticHTML(ctx, p)
 
 		err = TrySetCache(ctx, p, ctx.Response.Body())
@@ -133,15 +151,27 @@ func (s *SiteServer) RegistGet(rule string, p IPage) {
 			// ctx.SetStatusCode(fasthttp.StatusInternalServerError)
 			return
 		}
+	}
+}
 
-	})
+// doAuthErr redirect to login url of page, group or site
+func doAuthErr(pa *PageAttr, ctx *fasthttp.RequestCtx, loginURL string) {
+	if len(pa.LoginURL) > 0 {
+		loginURL = pa.LoginURL
+	}
+	if len(loginURL) == 0 {
+		loginURL = pa.SiteData.LoginURL
+	}
+	redirectLogin(ctx, loginURL)
 }
 
-// RegistPost router
-func (s *SiteServer) RegistPost(rule string, p IPage) {
-	s.Router.POST(rule, func(ctx *fasthttp.RequestCtx) {
-		// ctx.SetStatusCode(fasthttp.StatusForbidden)
-	})
+// redirectLogin with url of request
+func redirectLogin(ctx *fasthttp.RequestCtx, loginURL string) {
+	u, _ := url.Parse(loginURL)
+	dat := u.Query()
+	dat.Add(sAuthURL, string(ctx.RequestURI()))
+	u.RawQuery = dat.Encode()
+	ctx.Redirect(u.String(), fasthttp.StatusSeeOther)
 }
 
 func doPageErr(pd *PageAttr, ctx *fasthttp.RequestCtx, err error) {
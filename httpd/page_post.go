@@ -0,0 +1,111 @@
+package httpd
+
+import (
+	"github.com/kere/gno/libs/util"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	formKey = "_form"
+
+	// FormField form values of default page data when validation failed
+	FormField = "Form"
+	// ErrorsField field errors of default page data when validation failed
+	ErrorsField = "Errors"
+)
+
+// PageRedirect returned by Page to redirect after post
+type PageRedirect struct {
+	URL    string
+	Status int
+}
+
+// Redirect post-redirect-get, status 303
+func Redirect(url string) *PageRedirect {
+	return &PageRedirect{URL: url, Status: fasthttp.StatusSeeOther}
+}
+
+// ValidationError returned by Page, the page is rendered again with status 422
+type ValidationError struct {
+	// Errors field: message
+	Errors map[string]string
+	// Data page data, default is {"Form": Form(ctx), "Errors": Errors}
+	Data interface{}
+}
+
+// NewValidationError field errors
+func NewValidationError(errs map[string]string) *ValidationError {
+	return &ValidationError{Errors: errs}
+}
+
+// Add field error
+func (e *ValidationError) Add(field, msg string) *ValidationError {
+	if e.Errors == nil {
+		e.Errors = make(map[string]string)
+	}
+	e.Errors[field] = msg
+	return e
+}
+
+// HasError of any field
+func (e *ValidationError) HasError() bool {
+	return len(e.Errors) > 0
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed"
+}
+
+// PageData render data
+func (e *ValidationError) PageData(ctx *fasthttp.RequestCtx) interface{} {
+	if e.Data != nil {
+		return e.Data
+	}
+	return util.MapData{FormField: Form(ctx), ErrorsField: e.Errors}
+}
+
+// Form values of post body, urlencoded or multipart.
+// A field of multiple values is []string.
+func Form(ctx *fasthttp.RequestCtx) util.MapData {
+	if form, ok := ctx.UserValue(formKey).(util.MapData); ok {
+		return form
+	}
+
+	form := util.MapData{}
+	if mf, err := ctx.MultipartForm(); err == nil {
+		for k, v := range mf.Value {
+			if len(v) == 1 {
+				form[k] = v[0]
+			} else {
+				form[k] = v
+			}
+		}
+	} else {
+		args := ctx.PostArgs()
+		args.VisitAll(func(key, value []byte) {
+			k := string(key)
+			if len(args.PeekMulti(k)) > 1 {
+				arr, _ := form[k].([]string)
+				form[k] = append(arr, string(value))
+				return
+			}
+			form[k] = string(value)
+		})
+	}
+
+	ctx.SetUserValue(formKey, form)
+	return form
+}
+
+// FormValue string value of form field
+func FormValue(ctx *fasthttp.RequestCtx, name string) string {
+	switch v := Form(ctx)[name].(type) {
+	case string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
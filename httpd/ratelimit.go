@@ -0,0 +1,241 @@
+package httpd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kere/gno/libs/cache"
+	"github.com/kere/gno/libs/conf"
+	"github.com/kere/gno/libs/log"
+	"github.com/kere/gno/libs/redis"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	rateLimitPrefix = "rl:"
+	// memory buckets are swept every n takes
+	rateLimitSweepN = 10000
+)
+
+// RateLimitStore token buckets
+type RateLimitStore interface {
+	// Take a token of key, it returns the wait duration if no token is left
+	Take(key string, rate float64, burst int) (bool, time.Duration, error)
+}
+
+// RateKeyFunc key of bucket, "" is not limited
+type RateKeyFunc func(ctx *fasthttp.RequestCtx) string
+
+// RateLimit token bucket limit
+type RateLimit struct {
+	// Name prefix of keys, routes of the same name share buckets
+	Name string
+	// Rate tokens per second
+	Rate float64
+	// Burst bucket capacity, default is ceil(Rate)
+	Burst int
+	// Key default is RateKeyIP
+	Key RateKeyFunc
+	// Store default is a memory store
+	Store RateLimitStore
+}
+
+// RateKeyIP remote ip
+func RateKeyIP(ctx *fasthttp.RequestCtx) string {
+	return ctx.RemoteIP().String()
+}
+
+// RateKeyUser user id resolved by auth, ip if it is not set.
+// Site and group middleware run before page auth, they limit by ip,
+// use it as a route middleware to limit by user.
+func RateKeyUser(ctx *fasthttp.RequestCtx) string {
+	if uid := ctx.UserValue(FieldUserID); uid != nil {
+		return "u:" + fmt.Sprint(uid)
+	}
+	return RateKeyIP(ctx)
+}
+
+// RateKeyHeader api key of header, ip if it is empty or not valid.
+// valid is required, keys sent by clients are not trusted.
+func RateKeyHeader(name string, valid func(key string) bool) RateKeyFunc {
+	if valid == nil {
+		panic("httpd: RateKeyHeader " + name + " needs a validator")
+	}
+	return func(ctx *fasthttp.RequestCtx) string {
+		if v := ctx.Request.Header.Peek(name); len(v) > 0 && valid(string(v)) {
+			return "k:" + string(v)
+		}
+		return RateKeyIP(ctx)
+	}
+}
+
+// ParseRate 10/s 100/m 1000/h
+func ParseRate(str string) (float64, error) {
+	arr := strings.SplitN(strings.TrimSpace(str), Slash, 2)
+	n, err := strconv.ParseFloat(arr[0], 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("invalid rate " + str)
+	}
+	if len(arr) == 1 {
+		return n, nil
+	}
+	switch arr[1] {
+	case "s":
+		return n, nil
+	case "m":
+		return n / 60, nil
+	case "h":
+		return n / 3600, nil
+	}
+	return 0, errors.New("invalid rate " + str)
+}
+
+// RateLimiter middleware, 429 with Retry-After when the bucket is empty.
+// Requests are passed if the store fails.
+// It runs before page auth if it is a site or group middleware,
+// and after auth as a route middleware.
+func RateLimiter(rl RateLimit) Middleware {
+	if rl.Rate <= 0 {
+		panic("httpd: rate limit must be > 0")
+	}
+	if rl.Burst < 1 {
+		rl.Burst = int(math.Ceil(rl.Rate))
+	}
+	if rl.Key == nil {
+		rl.Key = RateKeyIP
+	}
+	if rl.Store == nil {
+		rl.Store = NewMemoryRateStore()
+	}
+	prefix := rateLimitPrefix + rl.Name + ":"
+
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			key := rl.Key(ctx)
+			if key == "" {
+				next(ctx)
+				return
+			}
+			ok, wait, err := rl.Store.Take(prefix+key, rl.Rate, rl.Burst)
+			if err != nil {
+				log.App.Warn("rate limit:", err)
+				next(ctx)
+				return
+			}
+			if !ok {
+				sec := int(math.Ceil(wait.Seconds()))
+				if sec < 1 {
+					sec = 1
+				}
+				// Error resets the headers
+				ctx.Error(fasthttp.StatusMessage(fasthttp.StatusTooManyRequests), fasthttp.StatusTooManyRequests)
+				ctx.Response.Header.Set(fasthttp.HeaderRetryAfter, strconv.Itoa(sec))
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// newRateLimit by config section: rate=10/s, burst, key=ip|user, store=memory|redis.
+// Header keys need a validator, they are set by RateLimiter with RateKeyHeader.
+func newRateLimit(c conf.Conf) Middleware {
+	rate, err := ParseRate(c.DefaultString("rate", ""))
+	if err != nil {
+		panic("httpd: rate_limit " + err.Error())
+	}
+	rl := RateLimit{Name: "site", Rate: rate, Burst: c.DefaultInt("burst", 0)}
+
+	switch key := c.DefaultString("key", "ip"); {
+	case key == "user":
+		rl.Key = RateKeyUser
+	case key == "ip":
+	default:
+		panic("httpd: rate_limit key=" + key + " is not supported, header keys need RateLimiter with RateKeyHeader")
+	}
+
+	if c.DefaultString("store", "memory") == "redis" {
+		rl.Store = NewRedisRateStore(cache.GetRedis())
+	}
+	return RateLimiter(rl)
+}
+
+// memoryBucket token bucket
+type memoryBucket struct {
+	tokens float64
+	last   time.Time
+	// full refill duration
+	full time.Duration
+}
+
+// MemoryRateStore token buckets in memory of this process
+type MemoryRateStore struct {
+	lock    sync.Mutex
+	buckets map[string]*memoryBucket
+	n       int
+}
+
+// NewMemoryRateStore memory store
+func NewMemoryRateStore() *MemoryRateStore {
+	return &MemoryRateStore{buckets: make(map[string]*memoryBucket)}
+}
+
+// Take token
+func (m *MemoryRateStore) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	now := time.Now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.n++
+	if m.n >= rateLimitSweepN {
+		m.n = 0
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(burst), last: now, full: time.Duration(float64(burst) / rate * float64(time.Second))}
+		m.buckets[key] = b
+	} else {
+		b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second)), nil
+}
+
+// sweep full buckets, they are the same as new ones
+func (m *MemoryRateStore) sweep(now time.Time) {
+	for k, b := range m.buckets {
+		if now.Sub(b.last) > b.full {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+// RedisRateStore token buckets shared by processes
+type RedisRateStore struct {
+	pool *redis.Pool
+}
+
+// NewRedisRateStore redis store
+func NewRedisRateStore(pool *redis.Pool) *RedisRateStore {
+	if pool == nil {
+		panic("httpd: redis is not initalized")
+	}
+	return &RedisRateStore{pool: pool}
+}
+
+// Take token
+func (r *RedisRateStore) Take(key string, rate float64, burst int) (bool, time.Duration, error) {
+	return r.pool.TakeToken(key, rate, burst)
+}
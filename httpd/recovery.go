@@ -0,0 +1,88 @@
+package httpd
+
+import (
+	"fmt"
+	"net/url"
+	"runtime/debug"
+
+	"github.com/kere/gno/libs/log"
+	"github.com/kere/gno/libs/util"
+	"github.com/valyala/fasthttp"
+)
+
+// recovery log panic with stack, pages respond the error page with status 500,
+// pa: attr of page, its ErrorURL is used before the site one
+func (s *SiteServer) recovery(kind int, pa *PageAttr) Middleware {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				logPanic(requestInfo(ctx), p)
+				if kind == routePage {
+					errorURL := s.SiteData.ErrorURL
+					if pa != nil && pa.ErrorURL != "" {
+						errorURL = pa.ErrorURL
+					}
+					s.errorPage(ctx, errorURL, fmt.Sprint(p))
+					return
+				}
+				ctx.ResetBody()
+				ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// errorPage render errorURL route with status 500, the request uri is restored
+func (s *SiteServer) errorPage(ctx *fasthttp.RequestCtx, errorURL, msg string) {
+	path := util.Bytes2Str(ctx.Path())
+	ctx.Response.Reset()
+	if errorURL == "" || path == errorURL {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	uri := string(ctx.RequestURI())
+	method := string(ctx.Method())
+	defer func() {
+		if p := recover(); p != nil {
+			logPanic("error page "+errorURL, p)
+			ctx.Response.Reset()
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+		}
+		ctx.Request.SetRequestURI(uri)
+		ctx.Request.Header.SetMethod(method)
+	}()
+
+	if RunMode != ModeDev {
+		msg = fasthttp.StatusMessage(fasthttp.StatusInternalServerError)
+	}
+	ctx.Request.SetRequestURI(errorURL + "?msg=" + url.QueryEscape(msg))
+	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+	s.Router.Handler(ctx)
+	ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+}
+
+// callWSExec websocket method, a panic is returned as error
+func callWSExec(info, method string, exec wsExec, args util.MapData) (dat interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logPanic(info+" ws:"+method, p)
+			err = fmt.Errorf("%s: internal error", method)
+		}
+	}()
+	return exec(args)
+}
+
+// requestInfo method uri ip
+func requestInfo(ctx *fasthttp.RequestCtx) string {
+	return string(ctx.Method()) + " " + string(ctx.RequestURI()) + " " + ctx.RemoteIP().String()
+}
+
+func logPanic(info string, p interface{}) {
+	log.App.Error("panic:", p, info, "\n"+string(debug.Stack()))
+}
@@ -1,6 +1,7 @@
 package httpd
 
 import (
+	"html/template"
 	"io"
 )
 
@@ -18,6 +19,8 @@ var (
 	TemplateLeftDelim = ""
 	// TemplateRightDelim for template
 	TemplateRightDelim = ""
+	// TemplateFuncs functions of template, url: reverse route
+	TemplateFuncs = template.FuncMap{"url": URL}
 
 	// BytesEqual equal
 	BytesEqual = []byte("=")
@@ -34,7 +34,7 @@ func NewTemplate(fileName string) *Template {
 
 // NewTemplateS new
 func NewTemplateS(src string) *Template {
-	tmpl := template.New("")
+	tmpl := template.New("").Funcs(TemplateFuncs)
 	if TemplateLeftDelim != "" {
 		tmpl.Delims(TemplateLeftDelim, TemplateRightDelim)
 	}
@@ -71,7 +71,7 @@ func (t *Template) RenderD(w io.Writer, data interface{}) error {
 
 	// dynamic htm
 	if t.tmpl == nil {
-		t.tmpl = template.New(filepath.Base(t.FileName))
+		t.tmpl = template.New(filepath.Base(t.FileName)).Funcs(TemplateFuncs)
 
 		if TemplateLeftDelim != "" {
 			t.tmpl.Delims(TemplateLeftDelim, TemplateRightDelim)
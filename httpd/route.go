@@ -0,0 +1,214 @@
+package httpd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// AuthFunc group auth, run before the auth of page, api, upload and websocket
+type AuthFunc func(ctx *fasthttp.RequestCtx) error
+
+const (
+	routePage = iota
+	routeAPI
+)
+
+// RouteGroup routes of the same prefix, middleware and auth
+type RouteGroup struct {
+	site        *SiteServer
+	prefix      string
+	middlewares []Middleware
+	auth        AuthFunc
+	loginURL    string
+}
+
+// Group of prefix, mw: group middleware
+func (s *SiteServer) Group(prefix string, mw ...Middleware) *RouteGroup {
+	return &RouteGroup{site: s, prefix: strings.TrimRight(prefix, Slash), middlewares: mw}
+}
+
+// Group sub group, middleware, auth and login url are inherited
+func (g *RouteGroup) Group(prefix string, mw ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		site:        g.site,
+		prefix:      g.prefix + strings.TrimRight(prefix, Slash),
+		middlewares: append(g.copyMiddlewares(), mw...),
+		auth:        g.auth,
+		loginURL:    g.loginURL,
+	}
+}
+
+// Prefix of group
+func (g *RouteGroup) Prefix() string {
+	return g.prefix
+}
+
+// Use group middleware, routes registered later are applied
+func (g *RouteGroup) Use(mw ...Middleware) *RouteGroup {
+	g.middlewares = append(g.middlewares, mw...)
+	return g
+}
+
+// SetAuth group auth. Pages are redirected to login url if it fails, others are 403
+func (g *RouteGroup) SetAuth(f AuthFunc) *RouteGroup {
+	g.auth = f
+	return g
+}
+
+// SetLoginURL login url of group pages without PageAttr.LoginURL, default is site login url
+func (g *RouteGroup) SetLoginURL(u string) *RouteGroup {
+	g.loginURL = u
+	return g
+}
+
+// NameRoute route name for URL, rule is in group
+func (g *RouteGroup) NameRoute(name, rule string) *RouteGroup {
+	g.site.NameRoute(name, g.prefix+rule)
+	return g
+}
+
+// RegistGet page, it is redirected to login url of group if Auth of page fails
+func (g *RouteGroup) RegistGet(rule string, p IPage, mw ...Middleware) {
+	g.site.routePage(fasthttp.MethodGet, g.prefix+rule, p, g.site.pageHandler(p, false, g.loginURL), g.chain(routePage, mw))
+}
+
+// RegistPost page
+func (g *RouteGroup) RegistPost(rule string, p IPage, mw ...Middleware) {
+	g.site.routePage(fasthttp.MethodPost, g.prefix+rule, p, g.site.pageHandler(p, true, g.loginURL), g.chain(routePage, mw))
+}
+
+// RegistOpenAPI open api
+func (g *RouteGroup) RegistOpenAPI(rule string, openapi IOpenAPI, mw ...Middleware) {
+	g.site.RegistOpenAPI(g.prefix+rule, openapi, g.chain(routeAPI, mw)...)
+}
+
+// RegistUpload upload
+func (g *RouteGroup) RegistUpload(rule string, up IUpload, mw ...Middleware) {
+	g.site.RegistUpload(g.prefix+rule, up, g.chain(routeAPI, mw)...)
+}
+
+// RegistWS websocket
+func (g *RouteGroup) RegistWS(rule string, w IWebSock, mw ...Middleware) {
+	g.site.RegistWS(g.prefix+rule, w, g.chain(routeAPI, mw)...)
+}
+
+func (g *RouteGroup) copyMiddlewares() []Middleware {
+	arr := make([]Middleware, len(g.middlewares))
+	copy(arr, g.middlewares)
+	return arr
+}
+
+// chain group middleware, auth, route middleware
+func (g *RouteGroup) chain(kind int, mw []Middleware) []Middleware {
+	arr := g.copyMiddlewares()
+	if g.auth != nil {
+		arr = append(arr, g.authMiddleware(kind))
+	}
+	return append(arr, mw...)
+}
+
+func (g *RouteGroup) authMiddleware(kind int) Middleware {
+	auth := g.auth
+	loginURL := g.loginURL
+	if loginURL == "" {
+		loginURL = g.site.SiteData.LoginURL
+	}
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			if err := auth(ctx); err != nil {
+				if kind == routePage {
+					redirectLogin(ctx, loginURL)
+				} else {
+					ctx.Error(err.Error(), fasthttp.StatusForbidden)
+				}
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// NameRoute route name for URL, rule: /user/:id/*path
+func (s *SiteServer) NameRoute(name, rule string) {
+	if s.routes == nil {
+		s.routes = make(map[string]string)
+	}
+	if _, ok := s.routes[name]; ok {
+		panic("httpd: route name " + name + " is already named")
+	}
+	s.routes[name] = rule
+}
+
+// URL reverse route of name, :name and *name of rule are replaced by params,
+// other params are added to query string
+func (s *SiteServer) URL(name string, params map[string]interface{}) (string, error) {
+	rule, ok := s.routes[name]
+	if !ok {
+		return "", errors.New("route " + name + " is not found")
+	}
+
+	used := make(map[string]bool)
+	parts := strings.Split(rule, Slash)
+	for i, part := range parts {
+		if len(part) < 2 || (part[0] != ':' && part[0] != '*') {
+			continue
+		}
+		key := part[1:]
+		v, ok := params[key]
+		if !ok {
+			return "", errors.New("route " + name + ": param " + key + " is required")
+		}
+		used[key] = true
+		str := fmt.Sprint(v)
+		if part[0] == '*' {
+			parts[i] = strings.TrimPrefix(escapePath(str), Slash)
+		} else {
+			parts[i] = url.PathEscape(str)
+		}
+	}
+	u := strings.Join(parts, Slash)
+
+	if len(params) == len(used) {
+		return u, nil
+	}
+	keys := make([]string, 0, len(params)-len(used))
+	for k := range params {
+		if !used[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	vals := url.Values{}
+	for _, k := range keys {
+		vals.Set(k, fmt.Sprint(params[k]))
+	}
+	return u + "?" + vals.Encode(), nil
+}
+
+// escapePath escape each segment of path
+func escapePath(p string) string {
+	arr := strings.Split(p, Slash)
+	for i := range arr {
+		arr[i] = url.PathEscape(arr[i])
+	}
+	return strings.Join(arr, Slash)
+}
+
+// URL reverse route of Site, key value pairs as params:
+//
+//	{{url "user" "id" .ID "tab" "info"}}
+func URL(name string, pairs ...interface{}) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", errors.New("route " + name + ": params must be key value pairs")
+	}
+	params := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		params[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+	return Site.URL(name, params)
+}
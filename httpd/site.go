@@ -2,9 +2,13 @@ package httpd
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/buaazp/fasthttprouter"
@@ -12,7 +16,6 @@ import (
 	"github.com/kere/gno/libs/cache"
 	"github.com/kere/gno/libs/conf"
 	"github.com/kere/gno/libs/log"
-	"github.com/kere/gno/libs/util"
 	"github.com/valyala/fasthttp"
 )
 
@@ -31,8 +34,7 @@ var (
 	// RunMode dev pro
 	RunMode = ModeDev
 	// Site svr
-	Site     *SiteServer
-	quitChan = make(chan os.Signal)
+	Site *SiteServer
 )
 
 func init() {
@@ -75,6 +77,35 @@ type SiteServer struct {
 	C          conf.Configuration
 
 	EnableFileHandler bool
+	// ShutdownTimeout drain timeout of signal shutdown
+	ShutdownTimeout time.Duration
+	// RedirectListen http listen address redirect to https
+	RedirectListen string
+	// CertReloadInterval check certificate files, 0: reload by SIGHUP only
+	CertReloadInterval time.Duration
+
+	tenantResolver  TenantResolver
+	tenantValidator TenantValidator
+	middlewares     []Middleware
+	// site middleware and dispatch
+	handler fasthttp.RequestHandler
+	// routes name: rule
+	routes map[string]string
+
+	startHooks    []StartHook
+	shutdownHooks []ShutdownHook
+	wsConns       sync.Map
+	stopOnce      sync.Once
+	stopErr       error
+	// closed when Stop begins
+	stopChan chan struct{}
+	// closed when Stop is done
+	stopDone chan struct{}
+
+	certs          *certStore
+	redirectLock   sync.Mutex
+	redirectServer *fasthttp.Server
+	redirectLn     net.Listener
 	// PageMap          map[string]IPage
 }
 
@@ -103,6 +134,11 @@ func Init(name string) {
 		cache.Init(Site.C.GetConf("cache"))
 		// db.SetCache(cache.CurrentCache())
 	}
+
+	// rate_limit: rate=10/s, burst, key=ip|user, store=memory|redis
+	if Site.C.IsSet("rate_limit") {
+		Site.Use(newRateLimit(Site.C.GetConf("rate_limit")))
+	}
 }
 
 // New Server
@@ -129,6 +165,11 @@ func New(name string) *SiteServer {
 
 	site.Log = log.Get("app")
 
+	// access log: format=combined|common|json, logname, logstore, level
+	if c.IsSet("access_log") {
+		site.Use(newAccessLog(c.GetConf("access_log")))
+	}
+
 	// ErrorURL
 	site.SiteData.ErrorURL = a.DefaultString("error_url", "/error")
 	// LoginURL
@@ -155,10 +196,21 @@ func New(name string) *SiteServer {
 	site.SiteData.CSSVersion = a.DefaultString("css_version", "")
 
 	site.EnableFileHandler = a.DefaultBool("enable_files_handle", true)
+	// seconds
+	site.ShutdownTimeout = time.Duration(a.DefaultInt("shutdown_timeout", 10)) * time.Second
+	site.stopChan = make(chan struct{})
+	site.stopDone = make(chan struct{})
+
+	// tls_cert, tls_key, tls_redirect, tls_reload_interval
+	site.initTLS(a)
+
+	// tenant = host | header:X-Tenant, tenants = acme,foo
+	site.tenantResolver = newTenantResolver(a.DefaultString("tenant", ""))
+	site.tenantValidator = newTenantValidator(a.DefaultString("tenants", ""))
 
 	site.Server = &fasthttp.Server{
 		ErrorHandler: site.ErrorHandler,
-		Handler:      site.Router.Handler,
+		Handler:      site.handle,
 	}
 
 	return site
@@ -215,35 +267,111 @@ func (s *SiteServer) Start() {
 	fmt.Println("RunMode:", RunMode)
 	fmt.Println("Listen:", s.Listen)
 
-	util.ListenSignal(func(sign os.Signal) {
-		if sign == os.Interrupt {
-			if s.PID != "" {
-				os.Remove(s.PID)
-			}
+	if err := s.runStartHooks(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ln, err := s.listen()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(0)
+	}
+
+	go s.listenSignal()
+
+	if err = s.serve(ln); err != nil {
+		fmt.Println(err)
+		os.Exit(0)
+	}
+}
+
+// listen by Listen: unix:path, tls by certificates or tcp4
+func (s *SiteServer) listen() (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(s.Listen, "unix:"):
+		addr := s.Listen[5:]
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		ln, err := net.Listen("unix", addr)
+		if err != nil {
+			return nil, err
+		}
+		return ln, os.Chmod(addr, os.ModePerm)
 
-			if err := s.Server.Shutdown(); err != nil {
-				fmt.Println(err)
+	case s.IsTLS():
+		ln, err := s.listenTLS(s.Listen)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("TLS certificates:", len(s.certs.pairs))
+		if s.RedirectListen != "" {
+			if err = s.startRedirect(); err != nil {
+				ln.Close()
+				return nil, err
 			}
 		}
-		os.Exit(0)
-	})
+		if s.CertReloadInterval > 0 {
+			go s.certs.watch(s, s.CertReloadInterval, s.stopChan)
+		}
+		return ln, nil
+	}
+	return net.Listen("tcp4", s.Listen)
+}
 
+// serve ln, it returns after Stop is done if it is stopped
+func (s *SiteServer) serve(ln net.Listener) error {
+	// Server.Shutdown does not close ln if Stop comes before Serve
+	served := make(chan struct{})
+	defer close(served)
 	go func() {
-		<-quitChan
+		select {
+		case <-s.stopDone:
+			ln.Close()
+		case <-served:
+		}
 	}()
+	err := s.Server.Serve(ln)
+	select {
+	case <-s.stopChan:
+		<-s.stopDone
+		return nil
+	default:
+		return err
+	}
+}
 
-	if strings.HasPrefix(s.Listen, "unix:") {
-		if err := s.Server.ListenAndServeUNIX(s.Listen[5:], os.ModePerm); err != nil {
-			fmt.Println(err)
-			os.Exit(0)
-		}
-	} else {
-		if err := s.Server.ListenAndServe(s.Listen); err != nil {
-			fmt.Println(err)
-			os.Exit(0)
+// listenSignal SIGINT SIGTERM stop, SIGHUP reload certificates if tls is on,
+// otherwise SIGHUP stops too
+func (s *SiteServer) listenSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sign := range c {
+		if sign == syscall.SIGHUP && s.IsTLS() {
+			s.ReloadCertificates()
+			continue
 		}
+		s.stopBySignal(sign)
+		os.Exit(0)
 	}
+}
 
+// handle request by site middleware, Server.Handler
+func (s *SiteServer) handle(ctx *fasthttp.RequestCtx) {
+	if s.handler != nil {
+		s.handler(ctx)
+		return
+	}
+	s.dispatch(ctx)
+}
+
+// dispatch request to router
+func (s *SiteServer) dispatch(ctx *fasthttp.RequestCtx) {
+	if !s.resolveTenant(ctx) {
+		return
+	}
+	s.Router.Handler(ctx)
 }
 
 // ErrorHandler do error
@@ -0,0 +1,125 @@
+package httpd
+
+import (
+	"strings"
+
+	"github.com/kere/gno/db"
+	"github.com/kere/gno/libs/util"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// TenantKey user value of request ctx
+	TenantKey = "tenant"
+
+	tenantByHost   = "host"
+	tenantByHeader = "header:"
+)
+
+// TenantResolver resolve tenant name of request, "" is no tenant
+type TenantResolver func(ctx *fasthttp.RequestCtx) string
+
+// TenantValidator return false if tenant name is unknown
+type TenantValidator func(name string) bool
+
+// SetTenantResolver resolve tenant for every request before routing
+func (s *SiteServer) SetTenantResolver(f TenantResolver) {
+	s.tenantResolver = f
+}
+
+// SetTenantValidator check resolved tenant, unknown tenant is responded with 404.
+// Resolvers trust the client, set a validator with header or host resolver.
+func (s *SiteServer) SetTenantValidator(f TenantValidator) {
+	s.tenantValidator = f
+}
+
+// TenantAllow validator of tenant names
+func TenantAllow(names ...string) TenantValidator {
+	m := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		m[cleanTenant(name)] = struct{}{}
+	}
+	return func(name string) bool {
+		_, ok := m[name]
+		return ok
+	}
+}
+
+// resolveTenant set tenant of request, false if it is not valid
+func (s *SiteServer) resolveTenant(ctx *fasthttp.RequestCtx) bool {
+	if s.tenantResolver == nil {
+		return true
+	}
+	name := s.tenantResolver(ctx)
+	if name == "" {
+		return true
+	}
+	if s.tenantValidator != nil && !s.tenantValidator(name) {
+		ctx.Error("unknown tenant", fasthttp.StatusNotFound)
+		return false
+	}
+	ctx.SetUserValue(TenantKey, name)
+	return true
+}
+
+// TenantFromHost first label of host: acme.example.com -> acme
+func TenantFromHost(ctx *fasthttp.RequestCtx) string {
+	host := util.Bytes2Str(ctx.Host())
+	if i := strings.IndexByte(host, ':'); i > -1 {
+		host = host[:i]
+	}
+	i := strings.IndexByte(host, '.')
+	if i < 1 || strings.Count(host, ".") < 2 {
+		return ""
+	}
+	return cleanTenant(host[:i])
+}
+
+// TenantFromHeader resolver of http header
+func TenantFromHeader(name string) TenantResolver {
+	return func(ctx *fasthttp.RequestCtx) string {
+		return cleanTenant(util.Bytes2Str(ctx.Request.Header.Peek(name)))
+	}
+}
+
+// Tenant name of request
+func Tenant(ctx *fasthttp.RequestCtx) string {
+	name, _ := ctx.UserValue(TenantKey).(string)
+	return name
+}
+
+// TenantDB current database scoped by tenant of request
+func TenantDB(ctx *fasthttp.RequestCtx) *db.Tenant {
+	return db.Current().ForTenant(Tenant(ctx))
+}
+
+// newTenantValidator by site config: tenants = acme,foo
+func newTenantValidator(str string) TenantValidator {
+	if str == "" {
+		return nil
+	}
+	return TenantAllow(strings.Split(str, Comma)...)
+}
+
+// newTenantResolver by site config: tenant = host | header:X-Tenant
+func newTenantResolver(str string) TenantResolver {
+	switch {
+	case str == tenantByHost:
+		return TenantFromHost
+	case strings.HasPrefix(str, tenantByHeader):
+		return TenantFromHeader(strings.TrimSpace(str[len(tenantByHeader):]))
+	}
+	return nil
+}
+
+// cleanTenant lower case, only a-z 0-9 _ - are allowed
+func cleanTenant(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return ""
+		}
+	}
+	return name
+}
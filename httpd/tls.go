@@ -0,0 +1,253 @@
+package httpd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kere/gno/libs/conf"
+	"github.com/kere/gno/libs/log"
+	"github.com/kere/gno/libs/util"
+	"github.com/valyala/fasthttp"
+)
+
+// certPair cert and key file
+type certPair struct {
+	cert, key string
+}
+
+// certStore certificates of hosts, reloaded without restart
+type certStore struct {
+	lock  sync.RWMutex
+	pairs []certPair
+	certs []tls.Certificate
+	// modified time of files when loaded
+	mods []time.Time
+}
+
+// AddCertificate cert/key file pair, the host of certificate is chosen by SNI,
+// the first one is the default
+func (s *SiteServer) AddCertificate(certFile, keyFile string) {
+	if s.certs == nil {
+		s.certs = &certStore{}
+	}
+	s.certs.pairs = append(s.certs.pairs, certPair{cert: certFile, key: keyFile})
+}
+
+// IsTLS certificates are set
+func (s *SiteServer) IsTLS() bool {
+	return s.certs != nil && len(s.certs.pairs) > 0
+}
+
+// ReloadCertificates load certificate files again, current certificates are kept if it fails
+func (s *SiteServer) ReloadCertificates() error {
+	if !s.IsTLS() {
+		return nil
+	}
+	if err := s.certs.load(); err != nil {
+		log.App.Error("reload certificates:", err)
+		return err
+	}
+	log.App.Notice("certificates reloaded")
+	return nil
+}
+
+// initTLS by [site] keys:
+//
+//	tls_cert = a.crt,b.crt
+//	tls_key = a.key,b.key
+//	tls_redirect = :80 (hosts of certificates only)
+//	tls_reload_interval = 60
+func (s *SiteServer) initTLS(a conf.Conf) {
+	certs := a.DefaultString("tls_cert", "")
+	if certs == "" {
+		return
+	}
+	certFiles := strings.Split(certs, Comma)
+	keyFiles := strings.Split(a.DefaultString("tls_key", ""), Comma)
+	if len(certFiles) != len(keyFiles) {
+		panic("httpd: tls_cert and tls_key are not paired")
+	}
+	for i := range certFiles {
+		s.AddCertificate(strings.TrimSpace(certFiles[i]), strings.TrimSpace(keyFiles[i]))
+	}
+	s.RedirectListen = a.DefaultString("tls_redirect", "")
+	s.CertReloadInterval = time.Duration(a.DefaultInt("tls_reload_interval", 60)) * time.Second
+}
+
+func (c *certStore) load() error {
+	certs := make([]tls.Certificate, len(c.pairs))
+	mods := make([]time.Time, len(c.pairs))
+	for i, p := range c.pairs {
+		cert, err := tls.LoadX509KeyPair(p.cert, p.key)
+		if err != nil {
+			return errors.New(p.cert + ": " + err.Error())
+		}
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return errors.New(p.cert + ": " + err.Error())
+		}
+		certs[i] = cert
+		mods[i] = c.modTime(p)
+	}
+
+	c.lock.Lock()
+	c.certs = certs
+	c.mods = mods
+	c.lock.Unlock()
+	return nil
+}
+
+// modTime latest of cert and key
+func (c *certStore) modTime(p certPair) time.Time {
+	var t time.Time
+	for _, name := range []string{p.cert, p.key} {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(t) {
+			t = info.ModTime()
+		}
+	}
+	return t
+}
+
+// isModified any file is changed since loaded
+func (c *certStore) isModified() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for i, p := range c.pairs {
+		if !c.modTime(p).Equal(c.mods[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// getCertificate by SNI
+func (c *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if len(c.certs) == 0 {
+		return nil, errors.New("no certificate")
+	}
+	if hello.ServerName != "" {
+		for i := range c.certs {
+			if c.certs[i].Leaf.VerifyHostname(hello.ServerName) == nil {
+				return &c.certs[i], nil
+			}
+		}
+	}
+	return &c.certs[0], nil
+}
+
+// watch reload certificates if files are changed
+func (c *certStore) watch(s *SiteServer, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if c.isModified() {
+				s.ReloadCertificates()
+			}
+		}
+	}
+}
+
+// listenTLS listener with certificates of store
+func (s *SiteServer) listenTLS(addr string) (net.Listener, error) {
+	if err := s.certs.load(); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.certs.getCertificate,
+		NextProtos:     []string{"http/1.1"},
+	}
+	return tls.NewListener(ln, cfg), nil
+}
+
+// hasHost a certificate is valid for host
+func (c *certStore) hasHost(host string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for i := range c.certs {
+		if c.certs[i].Leaf.VerifyHostname(host) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// startRedirect listen http and redirect to https,
+// only hosts of certificates are redirected
+func (s *SiteServer) startRedirect() error {
+	s.redirectLock.Lock()
+	defer s.redirectLock.Unlock()
+	select {
+	case <-s.stopChan:
+		return nil
+	default:
+	}
+
+	_, port, _ := net.SplitHostPort(s.Listen)
+	ln, err := net.Listen("tcp", s.RedirectListen)
+	if err != nil {
+		return err
+	}
+	srv := &fasthttp.Server{
+		Name: s.Name,
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			host := util.Bytes2Str(ctx.Host())
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if host == "" || !s.certs.hasHost(host) {
+				ctx.Error("unknown host", fasthttp.StatusBadRequest)
+				return
+			}
+			if port != "" && port != "443" {
+				host = net.JoinHostPort(host, port)
+			}
+			ctx.Redirect("https://"+host+string(ctx.RequestURI()), fasthttp.StatusMovedPermanently)
+		},
+	}
+	s.redirectServer = srv
+	s.redirectLn = ln
+	log.App.Notice("redirect listen:", s.RedirectListen)
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			log.App.Error("redirect listen:", err)
+		}
+	}()
+	return nil
+}
+
+// shutdownRedirect done is closed when redirect server is shut down
+func (s *SiteServer) shutdownRedirect() <-chan struct{} {
+	done := make(chan struct{})
+	s.redirectLock.Lock()
+	srv, ln := s.redirectServer, s.redirectLn
+	s.redirectServer, s.redirectLn = nil, nil
+	s.redirectLock.Unlock()
+	if srv == nil {
+		close(done)
+		return done
+	}
+	go func() {
+		srv.Shutdown()
+		// Shutdown does not close ln if it comes before Serve
+		ln.Close()
+		close(done)
+	}()
+	return done
+}
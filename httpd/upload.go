@@ -35,8 +35,8 @@ func doUploadErr(ctx *fasthttp.RequestCtx, err error) bool {
 }
 
 // RegistUpload router
-func (s *SiteServer) RegistUpload(rule string, up IUpload) {
-	s.Router.POST(rule, func(ctx *fasthttp.RequestCtx) {
+func (s *SiteServer) RegistUpload(rule string, up IUpload, mw ...Middleware) {
+	s.route(routeAPI, fasthttp.MethodPost, rule, func(ctx *fasthttp.RequestCtx) {
 		name := ctx.FormValue("name")
 		// filename := ctx.FormValue("filename") // filename to store
 		size := ctx.FormValue("size")
@@ -77,7 +77,7 @@ func (s *SiteServer) RegistUpload(rule string, up IUpload) {
 		// 	ctx.SetStatusCode(fasthttp.StatusBadRequest)
 		// 	return
 		// }
-	})
+	}, mw)
 }
 
 var filepool bytebufferpool.Pool
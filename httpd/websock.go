@@ -47,14 +47,14 @@ type messageRecv struct {
 }
 
 // RegistWS router
-func (s *SiteServer) RegistWS(rule string, w IWebSock) {
+func (s *SiteServer) RegistWS(rule string, w IWebSock, mw ...Middleware) {
 	buildWSExec(w)
 	var upgrader = websocket.FastHTTPUpgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
 	}
 
-	s.Router.GET(rule, func(ctx *fasthttp.RequestCtx) {
+	s.route(routeAPI, fasthttp.MethodGet, rule, func(ctx *fasthttp.RequestCtx) {
 		sign := ctx.QueryArgs().Peek(wsSignField)
 		sign2 := buildWSSign(&ctx.Request)
 		if string(sign) != sign2 {
@@ -67,8 +67,11 @@ func (s *SiteServer) RegistWS(rule string, w IWebSock) {
 			return
 		}
 
+		// ctx is released in upgrade handler
+		info := requestInfo(ctx)
 		err := upgrader.Upgrade(ctx, func(ws *websocket.Conn) {
 			defer ws.Close()
+			defer s.trackWS(ws)()
 			for {
 				var recv messageRecv
 				if err := ws.ReadJSON(&recv); err != nil {
@@ -79,7 +82,7 @@ func (s *SiteServer) RegistWS(rule string, w IWebSock) {
 					break
 				}
 
-				dat, err := wsExec(recv.Args)
+				dat, err := callWSExec(info, recv.Method, wsExec, recv.Args)
 				if err != nil {
 					if errW := ws.WriteJSON(map[string]interface{}{"iserror": true, "error": err.Error()}); errW != nil {
 						break
@@ -103,5 +106,5 @@ func (s *SiteServer) RegistWS(rule string, w IWebSock) {
 			return
 		}
 
-	})
+	}, mw)
 }
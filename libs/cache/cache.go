@@ -105,6 +105,16 @@ func Delete(key string) error {
 	return cache.Delete(key)
 }
 
+// Close redis pool
+func Close() {
+	if cache == nil || cache.GetDriver() != "redis" {
+		return
+	}
+	if p := cache.(*RedisCache).GetRedis(); p != nil {
+		p.Close()
+	}
+}
+
 // GetRedis return client
 func GetRedis() *redis.Pool {
 	if CurrentCache() == nil {
@@ -175,6 +175,17 @@ func New(folder, name, storeType, levelStr string) *Logger {
 	return l
 }
 
+// CloseAll close log files of all loggers
+func CloseAll() error {
+	var err error
+	for _, l := range pool {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // Use n log
 func Use(n string) {
 	App = pool[n]
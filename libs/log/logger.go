@@ -35,6 +35,7 @@ type Logger struct {
 	level     int
 	LevelName string
 	*golog.Logger
+	file *os.File
 }
 
 // NewLogger func
@@ -66,10 +67,11 @@ func (l *Logger) Init(file, levelStr string) *Logger {
 		fmt.Println("Logger is write in *.log file: " + file)
 		fmt.Println("Logger level name:", l.LevelName, " level value:", l.level)
 		var err error
-		out, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		l.file, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 		if err != nil {
 			golog.Fatalln(err)
 		}
+		out = l.file
 		// os.Chmod(file, 0664)
 	}
 	l.Logger = golog.New(out, "", 0)
@@ -78,6 +80,20 @@ func (l *Logger) Init(file, levelStr string) *Logger {
 	return l
 }
 
+// Close flush and close log file, messages are discarded after closed
+func (l *Logger) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.Logger.SetOutput(&emptyWriter{})
+	err := l.file.Sync()
+	if e := l.file.Close(); e != nil {
+		err = e
+	}
+	l.file = nil
+	return err
+}
+
 // SetLevel func
 func (l *Logger) SetLevel(s string) *Logger {
 	if l == nil {
@@ -88,6 +104,11 @@ func (l *Logger) SetLevel(s string) *Logger {
 	return l
 }
 
+// IsLevel messages of level will be written
+func (l *Logger) IsLevel(level int) bool {
+	return l != nil && l.level >= level
+}
+
 // SetPrefix func
 func (l *Logger) SetPrefix(prefix string) *Logger {
 	l.Logger.SetPrefix(prefix)
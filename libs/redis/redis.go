@@ -228,3 +228,44 @@ func (r *Pool) DoStringMap(m string, args ...interface{}) (map[string]string, er
 func (r *Pool) DoIntMap(m string, args ...interface{}) (map[string]int, error) {
 	return redis.IntMap(r.Do(m, args...))
 }
+
+// tokenBucketScript KEYS[1] bucket, ARGV rate per second, burst.
+// now is the redis server time, clocks of clients are not used
+var tokenBucketScript = redis.NewScript(1, `
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local v = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens = tonumber(v[1])
+local ts = tonumber(v[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+end
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HMSET', KEYS[1], 't', tostring(tokens), 'ts', tostring(math.max(now, ts)))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return wait
+`)
+
+// TakeToken token bucket of key, rate tokens per second, burst capacity.
+// It returns the wait duration if no token is left.
+func (r *Pool) TakeToken(key string, rate float64, burst int) (bool, time.Duration, error) {
+	c := r.Conn()
+	defer c.Close()
+	wait, err := redis.Int64(tokenBucketScript.Do(c, key, rate, burst))
+	if err != nil {
+		return false, 0, err
+	}
+	return wait == 0, time.Duration(wait) * time.Millisecond, nil
+}